@@ -0,0 +1,115 @@
+package buildkite
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+)
+
+// branchFilter is a Buildkite branch filter: patterns separated by spaces,
+// where * matches anything and a leading ! excludes the branches a pattern
+// matches. A branch passes when it matches no excluded pattern and any of the
+// other patterns, or when there are only excluded patterns.
+type branchFilter struct {
+	include []*regexp.Regexp
+	exclude []*regexp.Regexp
+}
+
+// parseBranchFilter parses a filter, reporting the first bad pattern along
+// with its column.
+func parseBranchFilter(s string) (*branchFilter, error) {
+	f := &branchFilter{}
+
+	for start := 0; start < len(s); {
+		if s[start] == ' ' || s[start] == '\t' || s[start] == '\n' {
+			start++
+			continue
+		}
+		end := strings.IndexAny(s[start:], " \t\n")
+		if end < 0 {
+			end = len(s)
+		} else {
+			end += start
+		}
+		pattern := s[start:end]
+
+		negated := strings.HasPrefix(pattern, "!")
+		name := strings.TrimPrefix(pattern, "!")
+		if err := validateBranchPattern(name); err != nil {
+			return nil, fmt.Errorf("column %d: %q %s", start+1, pattern, err)
+		}
+
+		re := regexp.MustCompile("^" + strings.Replace(regexp.QuoteMeta(name), `\*`, ".*", -1) + "$")
+		if negated {
+			f.exclude = append(f.exclude, re)
+		} else {
+			f.include = append(f.include, re)
+		}
+		start = end
+	}
+
+	return f, nil
+}
+
+// validateBranchPattern checks a pattern could match a branch, following the
+// rules git has for branch names.
+func validateBranchPattern(name string) error {
+	switch {
+	case name == "":
+		return fmt.Errorf("has nothing after the !")
+	case strings.HasPrefix(name, "!"):
+		return fmt.Errorf("can only be negated once")
+	case strings.HasPrefix(name, "-"):
+		return fmt.Errorf("can't start with -, branch names can't")
+	case strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.Contains(name, "//"):
+		return fmt.Errorf("has an empty path component, branch names can't")
+	case strings.HasSuffix(name, ".") || strings.HasSuffix(name, ".lock"):
+		return fmt.Errorf("can't end with . or .lock, branch names can't")
+	case strings.Contains(name, ".."), strings.Contains(name, "@{"):
+		return fmt.Errorf("can't contain .. or @{, branch names can't")
+	}
+
+	for _, r := range name {
+		if unicode.IsControl(r) {
+			return fmt.Errorf("can't contain control characters")
+		}
+		if strings.ContainsRune(`~^:?[\`, r) {
+			if strings.ContainsRune(`^?[\`, r) {
+				return fmt.Errorf("can't contain %q, branch filters only support * as a wildcard rather than regular expressions", r)
+			}
+			return fmt.Errorf("can't contain %q, branch names can't", r)
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") {
+			return fmt.Errorf("has a path component starting with ., branch names can't")
+		}
+	}
+	return nil
+}
+
+// Match reports whether the filter lets a branch through.
+func (f *branchFilter) Match(branch string) bool {
+	for _, re := range f.exclude {
+		if re.MatchString(branch) {
+			return false
+		}
+	}
+	if len(f.include) == 0 {
+		return true
+	}
+	for _, re := range f.include {
+		if re.MatchString(branch) {
+			return true
+		}
+	}
+	return false
+}
+
+func validateBranchFilter(v interface{}, k string) ([]string, []error) {
+	if _, err := parseBranchFilter(v.(string)); err != nil {
+		return nil, []error{fmt.Errorf("%s: %s", k, err)}
+	}
+	return nil, nil
+}
@@ -0,0 +1,88 @@
+package buildkite
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestBranchFilter_match(t *testing.T) {
+	branches := []string{"main", "stable/1.0", "stable/new", "feature/login", "v2.0", "login-test", "release/1.2"}
+
+	for pattern, expected := range map[string][]string{
+		"":                     branches,
+		"*":                    branches,
+		"main":                 {"main"},
+		"main feature/*":       {"main", "feature/login"},
+		"stable/* !stable/new": {"stable/1.0"},
+		"!main":                {"stable/1.0", "stable/new", "feature/login", "v2.0", "login-test", "release/1.2"},
+		"!main !stable/*":      {"feature/login", "v2.0", "login-test", "release/1.2"},
+		"*-test  v*.0":         {"v2.0", "login-test"},
+		"*login*":              {"feature/login", "login-test"},
+		"main\nstable/1.0":     {"main", "stable/1.0"},
+		"release/1.*":          {"release/1.2"},
+		"v*.*":                 {"v2.0"},
+	} {
+		f, err := parseBranchFilter(pattern)
+		if err != nil {
+			t.Errorf("%q: %s", pattern, err)
+			continue
+		}
+		matching := []string{}
+		for _, branch := range branches {
+			if f.Match(branch) {
+				matching = append(matching, branch)
+			}
+		}
+		if !reflect.DeepEqual(matching, expected) {
+			t.Errorf("%q: got %v, want %v", pattern, matching, expected)
+		}
+	}
+}
+
+func TestBranchFilter_errors(t *testing.T) {
+	for pattern, expected := range map[string]string{
+		"main !":             `column 6: "!" has nothing after the !`,
+		"!!main":             `column 1: "!!main" can only be negated once`,
+		"main release/[0-9]": `column 6: "release/[0-9]" can't contain '[', branch filters only support * as a wildcard`,
+		"feat~1":             `column 1: "feat~1" can't contain '~'`,
+		"^main$":             `column 1: "^main$" can't contain '^', branch filters only support * as a wildcard`,
+		"main feature/":      `column 6: "feature/" has an empty path component`,
+		"a..b":               `column 1: "a..b" can't contain .. or @{`,
+		"-main":              `column 1: "-main" can't start with -`,
+		"main.lock":          `column 1: "main.lock" can't end with . or .lock`,
+		"x/.hidden":          `column 1: "x/.hidden" has a path component starting with .`,
+	} {
+		_, err := parseBranchFilter(pattern)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected error %q, got %v", pattern, expected, err)
+		}
+	}
+}
+
+func TestReadBranchFilter(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, dataSourceBranchFilter().Schema, map[string]interface{}{
+		"pattern":  "main release/* !release/old",
+		"branches": []interface{}{"main", "release/1.0", "release/old", "feature/x"},
+	})
+
+	if err := ReadBranchFilter(d, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []interface{}{"main", "release/1.0"}
+	if matching := d.Get("matching_branches").([]interface{}); !reflect.DeepEqual(matching, expected) {
+		t.Errorf("got matching branches %v, want %v", matching, expected)
+	}
+	expectedMatches := map[string]interface{}{
+		"main":        true,
+		"release/1.0": true,
+		"release/old": false,
+		"feature/x":   false,
+	}
+	if matches := d.Get("matches").(map[string]interface{}); !reflect.DeepEqual(matches, expectedMatches) {
+		t.Errorf("got matches %v, want %v", matches, expectedMatches)
+	}
+}
@@ -14,6 +14,9 @@ import (
 type Client struct {
 	orgURL   *url.URL
 	apiToken string
+
+	// Tags added to every pipeline
+	defaultTags []string
 }
 
 func NewClient(orgURLStr, apiToken string) (*Client, error) {
@@ -32,6 +35,18 @@ func (c *Client) Get(pathParts []string, resBody interface{}) error {
 	return c.doJSON("GET", pathParts, nil, resBody)
 }
 
+// GetQuery is Get with query parameters.
+func (c *Client) GetQuery(pathParts []string, query url.Values, resBody interface{}) error {
+	req := c.createRawRequest("GET", pathParts, nil)
+	req.URL.RawQuery = query.Encode()
+
+	resBodyBytes, err := c.doRaw(req)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(resBodyBytes, resBody)
+}
+
 func (c *Client) Post(pathParts []string, reqBody, resBody interface{}) error {
 	return c.doJSON("POST", pathParts, reqBody, resBody)
 }
@@ -83,7 +98,7 @@ func (c *Client) doRaw(req *http.Request) ([]byte, error) {
 	log.Printf("[DEBUG] Buildkite Response %s\n", res.Status)
 
 	resBodyBytes, err := ioutil.ReadAll(res.Body)
-	log.Printf("[DEBUG] Buildkite Response Body %s\n", string(resBodyBytes))
+	log.Printf("[DEBUG] Buildkite Response Body %s\n", redactEnv(resBodyBytes))
 	if err != nil {
 		return nil, err
 	}
@@ -110,7 +125,7 @@ func (c *Client) doJSON(method string, pathParts []string, reqBody, resBody inte
 
 	req := c.createRawRequest(method, pathParts, reqBodyBytes)
 
-	log.Printf("[DEBUG] Buildkite Request Body %s\n", reqBodyBytes)
+	log.Printf("[DEBUG] Buildkite Request Body %s\n", redactEnv(reqBodyBytes))
 	resBodyBytes, err := c.doRaw(req)
 	if err != nil {
 		return err
@@ -122,6 +137,43 @@ func (c *Client) doJSON(method string, pathParts []string, reqBody, resBody inte
 	return nil
 }
 
+// redactEnv replaces the values of every env in a JSON body, which include
+// those of sensitive_env, so they stay out of the logs. Bodies which aren't
+// JSON are logged as they are.
+func redactEnv(body []byte) string {
+	var v interface{}
+	if len(body) == 0 || json.Unmarshal(body, &v) != nil {
+		return string(body)
+	}
+
+	var walk func(v interface{})
+	walk = func(v interface{}) {
+		switch v := v.(type) {
+		case map[string]interface{}:
+			for k, vI := range v {
+				if env, ok := vI.(map[string]interface{}); ok && k == "env" {
+					for name := range env {
+						env[name] = "(redacted)"
+					}
+					continue
+				}
+				walk(vI)
+			}
+		case []interface{}:
+			for _, vI := range v {
+				walk(vI)
+			}
+		}
+	}
+	walk(v)
+
+	redacted, err := json.MarshalIndent(v, "", "    ")
+	if err != nil {
+		return ""
+	}
+	return string(redacted)
+}
+
 type notFound struct {
 }
 
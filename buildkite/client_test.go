@@ -0,0 +1,133 @@
+package buildkite
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestRedactEnv(t *testing.T) {
+	body := `{
+  "env": {"DEPLOY_PASSWORD": "hunter2"},
+  "steps": [
+    {"type": "script", "env": {"NPM_TOKEN": "abc"}},
+    {"type": "group", "steps": [{"type": "script", "env": {"AWS_SECRET": "def"}}]}
+  ]
+}`
+	redacted := redactEnv([]byte(body))
+	for _, secret := range []string{"hunter2", "abc", "def"} {
+		if strings.Contains(redacted, secret) {
+			t.Errorf("expected %s to be redacted, got %s", secret, redacted)
+		}
+	}
+	for _, name := range []string{"DEPLOY_PASSWORD", "NPM_TOKEN", "AWS_SECRET"} {
+		if !strings.Contains(redacted, name) {
+			t.Errorf("expected %s to be kept, got %s", name, redacted)
+		}
+	}
+
+	if actual := redactEnv([]byte("404 page not found")); actual != "404 page not found" {
+		t.Errorf("expected a body which isn't JSON to be kept, got %s", actual)
+	}
+}
+
+// testAPI is a fake Buildkite API. It records requests as "METHOD path",
+// keeping the last JSON body sent to each, and answers them from its routes.
+// Requests without a route get a 404.
+type testAPI struct {
+	server   *httptest.Server
+	client   *Client
+	requests []string
+	bodies   map[string]string
+	routes   map[string]func(r *http.Request) string
+}
+
+// newTestAPI starts a fake API which answers 404 until routes are added.
+func newTestAPI(t *testing.T) *testAPI {
+	api := &testAPI{
+		bodies: map[string]string{},
+		routes: map[string]func(r *http.Request) string{},
+	}
+	api.server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		request := r.Method + " " + strings.TrimPrefix(r.URL.Path, "/")
+		api.requests = append(api.requests, request)
+		if body, _ := ioutil.ReadAll(r.Body); len(body) > 0 {
+			var compact bytes.Buffer
+			if err := json.Compact(&compact, body); err != nil {
+				t.Errorf("%s: %s", request, err)
+			}
+			api.bodies[request] = compact.String()
+		}
+
+		if fn := api.route(request); fn != nil {
+			if body := fn(r); body != "" {
+				fmt.Fprint(w, body)
+				return
+			}
+		}
+		http.NotFound(w, r)
+	}))
+
+	client, err := NewClient(api.server.URL+"/", "test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	api.client = client
+	return api
+}
+
+func (api *testAPI) Close() {
+	api.server.Close()
+}
+
+// route finds the route of a request. Routes ending in * match any request
+// starting with the rest of the route.
+func (api *testAPI) route(request string) func(r *http.Request) string {
+	if fn, ok := api.routes[request]; ok {
+		return fn
+	}
+	for route, fn := range api.routes {
+		if strings.HasSuffix(route, "*") && strings.HasPrefix(request, strings.TrimSuffix(route, "*")) {
+			return fn
+		}
+	}
+	return nil
+}
+
+// Respond answers a route with a fixed body.
+func (api *testAPI) Respond(route, body string) {
+	api.Handle(route, func(r *http.Request) string { return body })
+}
+
+// RespondPages answers a paginated list, with an empty page after the last.
+func (api *testAPI) RespondPages(route string, pages ...string) {
+	api.Handle(route, func(r *http.Request) string {
+		page, _ := strconv.Atoi(r.URL.Query().Get("page"))
+		if page < 1 || page > len(pages) {
+			return "[]"
+		}
+		return pages[page-1]
+	})
+}
+
+// Handle answers a route with the body fn returns, or a 404 when it is empty.
+func (api *testAPI) Handle(route string, fn func(r *http.Request) string) {
+	api.routes[route] = fn
+}
+
+// Requests returns the requests made, leaving out the ones given.
+func (api *testAPI) Requests(except ...string) []string {
+	var requests []string
+	for _, request := range api.requests {
+		if !containsString(except, request) {
+			requests = append(requests, request)
+		}
+	}
+	return requests
+}
@@ -0,0 +1,442 @@
+package buildkite
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// Buildkite conditionals, as used by step and notification if attributes and
+// filter_condition, e.g. build.branch == "main" && build.message !~ /skip/.
+// They are parsed here so mistakes are reported by plan rather than when the
+// pipeline is uploaded.
+
+// conditionalVariables are the variables conditionals can use. List variables
+// can be used with includes.
+var conditionalVariables = map[string]bool{
+	"build.author.email":                 false,
+	"build.author.id":                    false,
+	"build.author.name":                  false,
+	"build.author.teams":                 true,
+	"build.branch":                       false,
+	"build.commit":                       false,
+	"build.creator.email":                false,
+	"build.creator.id":                   false,
+	"build.creator.name":                 false,
+	"build.creator.teams":                true,
+	"build.id":                           false,
+	"build.merge_queue.base_branch":      false,
+	"build.merge_queue.base_commit":      false,
+	"build.message":                      false,
+	"build.number":                       false,
+	"build.pull_request.base_branch":     false,
+	"build.pull_request.draft":           false,
+	"build.pull_request.id":              false,
+	"build.pull_request.labels":          true,
+	"build.pull_request.repository":      false,
+	"build.pull_request.repository.fork": false,
+	"build.source":                       false,
+	"build.state":                        false,
+	"build.tag":                          false,
+	"organization.id":                    false,
+	"organization.slug":                  false,
+	"pipeline.default_branch":            false,
+	"pipeline.id":                        false,
+	"pipeline.repository":                false,
+	"pipeline.slug":                      false,
+}
+
+// conditionalFunctions are the functions conditionals can call, by the number
+// of arguments they take.
+var conditionalFunctions = map[string]int{
+	"build.env": 1,
+}
+
+type conditionalError struct {
+	Column  int
+	Message string
+}
+
+func (e *conditionalError) Error() string {
+	return fmt.Sprintf("column %d: %s", e.Column, e.Message)
+}
+
+type conditionalTokenKind int
+
+const (
+	tokenEOF conditionalTokenKind = iota
+	tokenIdent
+	tokenString
+	tokenNumber
+	tokenRegexp
+	tokenOperator
+)
+
+type conditionalToken struct {
+	Kind   conditionalTokenKind
+	Value  string
+	Column int
+}
+
+func (t conditionalToken) String() string {
+	if t.Kind == tokenEOF {
+		return "the end of the expression"
+	}
+	return strconv.Quote(t.Value)
+}
+
+var conditionalOperators = []string{"==", "!=", "=~", "!~", "&&", "||", "!", "(", ")", ","}
+
+var conditionalIdentRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*`)
+
+// lexConditional splits a conditional into tokens.
+func lexConditional(s string) ([]conditionalToken, error) {
+	var tokens []conditionalToken
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		column := i + 1
+
+		switch {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+
+		case c == '"' || c == '\'':
+			value, n, err := lexQuoted(s[i:], c)
+			if err != nil {
+				return nil, &conditionalError{column, err.Error()}
+			}
+			tokens = append(tokens, conditionalToken{tokenString, value, column})
+			i += n
+
+		case c == '/':
+			value, n, err := lexQuoted(s[i:], '/')
+			if err != nil {
+				return nil, &conditionalError{column, err.Error()}
+			}
+			i += n
+			// Flags follow the closing slash
+			for i < len(s) && s[i] == 'i' {
+				value = "(?i)" + value
+				i++
+			}
+			if _, err := regexp.Compile(value); err != nil {
+				return nil, &conditionalError{column, fmt.Sprintf("invalid regular expression: %s", err)}
+			}
+			tokens = append(tokens, conditionalToken{tokenRegexp, value, column})
+
+		case c >= '0' && c <= '9':
+			n := i
+			for n < len(s) && s[n] >= '0' && s[n] <= '9' {
+				n++
+			}
+			tokens = append(tokens, conditionalToken{tokenNumber, s[i:n], column})
+			i = n
+
+		case conditionalIdentRegexp.MatchString(s[i:]):
+			ident := conditionalIdentRegexp.FindString(s[i:])
+			tokens = append(tokens, conditionalToken{tokenIdent, ident, column})
+			i += len(ident)
+
+		default:
+			op := ""
+			for _, candidate := range conditionalOperators {
+				if strings.HasPrefix(s[i:], candidate) {
+					op = candidate
+					break
+				}
+			}
+			if op == "" {
+				return nil, &conditionalError{column, fmt.Sprintf("unexpected %q", s[i:i+1])}
+			}
+			tokens = append(tokens, conditionalToken{tokenOperator, op, column})
+			i += len(op)
+		}
+	}
+
+	return append(tokens, conditionalToken{Kind: tokenEOF, Column: len(s) + 1}), nil
+}
+
+// lexQuoted reads a string or regular expression delimited by quote, and
+// returns its value and length.
+func lexQuoted(s string, quote byte) (string, int, error) {
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case quote:
+			return b.String(), i + 1, nil
+		case '\\':
+			if i+1 < len(s) {
+				i++
+				// Regular expressions keep their escapes
+				if quote == '/' && s[i] != '/' {
+					b.WriteByte('\\')
+				}
+				b.WriteByte(s[i])
+				continue
+			}
+		}
+		b.WriteByte(s[i])
+	}
+	if quote == '/' {
+		return "", 0, fmt.Errorf("regular expression is missing its closing /")
+	}
+	return "", 0, fmt.Errorf("string is missing its closing %c", quote)
+}
+
+// conditionalExpr is a node of a parsed conditional. String renders it fully
+// parenthesised.
+type conditionalExpr interface {
+	String() string
+}
+
+type (
+	conditionalBinary struct {
+		Op          string
+		Left, Right conditionalExpr
+	}
+	conditionalNot struct {
+		X conditionalExpr
+	}
+	conditionalVariable struct {
+		Name string
+	}
+	conditionalCall struct {
+		Name string
+		Args []conditionalExpr
+	}
+	conditionalLiteral struct {
+		Token conditionalToken
+	}
+)
+
+func (e *conditionalBinary) String() string {
+	return fmt.Sprintf("(%s %s %s)", e.Left, e.Op, e.Right)
+}
+
+func (e *conditionalNot) String() string {
+	return fmt.Sprintf("!%s", e.X)
+}
+
+func (e *conditionalVariable) String() string {
+	return e.Name
+}
+
+func (e *conditionalCall) String() string {
+	args := make([]string, len(e.Args))
+	for i, arg := range e.Args {
+		args[i] = arg.String()
+	}
+	return fmt.Sprintf("%s(%s)", e.Name, strings.Join(args, ", "))
+}
+
+func (e *conditionalLiteral) String() string {
+	switch e.Token.Kind {
+	case tokenString:
+		return strconv.Quote(e.Token.Value)
+	case tokenRegexp:
+		return "/" + strings.Replace(e.Token.Value, "/", `\/`, -1) + "/"
+	}
+	return e.Token.Value
+}
+
+type conditionalParser struct {
+	tokens []conditionalToken
+	pos    int
+}
+
+// parseConditional parses a conditional, reporting the first error along with
+// its column.
+func parseConditional(s string) (conditionalExpr, error) {
+	tokens, err := lexConditional(s)
+	if err != nil {
+		return nil, err
+	}
+	p := &conditionalParser{tokens: tokens}
+
+	if p.peek().Kind == tokenEOF {
+		return nil, &conditionalError{1, "the expression is empty"}
+	}
+	expr, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if t := p.peek(); t.Kind != tokenEOF {
+		return nil, p.errorf(t, "expected an operator, got %s", t)
+	}
+	return expr, nil
+}
+
+func (p *conditionalParser) peek() conditionalToken {
+	return p.tokens[p.pos]
+}
+
+func (p *conditionalParser) next() conditionalToken {
+	t := p.tokens[p.pos]
+	if t.Kind != tokenEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *conditionalParser) isOperator(ops ...string) bool {
+	t := p.peek()
+	if t.Kind == tokenIdent && t.Value == "includes" {
+		return containsString(ops, "includes")
+	}
+	return t.Kind == tokenOperator && containsString(ops, t.Value)
+}
+
+func (p *conditionalParser) errorf(t conditionalToken, format string, args ...interface{}) error {
+	return &conditionalError{t.Column, fmt.Sprintf(format, args...)}
+}
+
+func (p *conditionalParser) or() (conditionalExpr, error) {
+	left, err := p.and()
+	for err == nil && p.isOperator("||") {
+		op := p.next().Value
+		var right conditionalExpr
+		right, err = p.and()
+		left = &conditionalBinary{op, left, right}
+	}
+	return left, err
+}
+
+func (p *conditionalParser) and() (conditionalExpr, error) {
+	left, err := p.comparison()
+	for err == nil && p.isOperator("&&") {
+		op := p.next().Value
+		var right conditionalExpr
+		right, err = p.comparison()
+		left = &conditionalBinary{op, left, right}
+	}
+	return left, err
+}
+
+func (p *conditionalParser) comparison() (conditionalExpr, error) {
+	leftToken := p.peek()
+	left, err := p.unary()
+	if err != nil || !p.isOperator("==", "!=", "=~", "!~", "includes") {
+		return left, err
+	}
+
+	opToken := p.next()
+	rightToken := p.peek()
+	right, err := p.primary()
+	if err != nil {
+		return nil, err
+	}
+
+	switch opToken.Value {
+	case "=~", "!~":
+		if rightToken.Kind != tokenRegexp {
+			return nil, p.errorf(rightToken, "%s needs a regular expression such as /^main$/, got %s", opToken.Value, rightToken)
+		}
+	case "includes":
+		v, ok := left.(*conditionalVariable)
+		if !ok || !conditionalVariables[v.Name] {
+			return nil, p.errorf(leftToken, "includes needs a list such as build.pull_request.labels on its left")
+		}
+	}
+	if rightToken.Kind == tokenRegexp && opToken.Value != "=~" && opToken.Value != "!~" {
+		return nil, p.errorf(rightToken, "regular expressions can only be used with =~ and !~")
+	}
+	if leftToken.Kind == tokenRegexp {
+		return nil, p.errorf(leftToken, "regular expressions can only be on the right of =~ and !~")
+	}
+
+	return &conditionalBinary{opToken.Value, left, right}, nil
+}
+
+// unary binds ! tighter than comparisons, so !a == b compares !a with b.
+func (p *conditionalParser) unary() (conditionalExpr, error) {
+	if p.isOperator("!") {
+		p.next()
+		x, err := p.unary()
+		return &conditionalNot{x}, err
+	}
+	return p.primary()
+}
+
+func (p *conditionalParser) primary() (conditionalExpr, error) {
+	t := p.next()
+
+	switch t.Kind {
+	case tokenString, tokenNumber, tokenRegexp:
+		return &conditionalLiteral{t}, nil
+
+	case tokenIdent:
+		switch t.Value {
+		case "true", "false", "null":
+			return &conditionalLiteral{t}, nil
+		}
+		if p.isOperator("(") {
+			return p.call(t)
+		}
+		if _, ok := conditionalVariables[t.Value]; !ok {
+			names := make([]string, 0, len(conditionalVariables))
+			for name := range conditionalVariables {
+				names = append(names, name)
+			}
+			if suggestion := suggestKey(t.Value, names); suggestion != "" {
+				return nil, p.errorf(t, "unknown variable %s, did you mean %s?", t.Value, suggestion)
+			}
+			return nil, p.errorf(t, "unknown variable %s", t.Value)
+		}
+		return &conditionalVariable{t.Value}, nil
+
+	case tokenOperator:
+		if t.Value == "(" {
+			expr, err := p.or()
+			if err != nil {
+				return nil, err
+			}
+			if closing := p.next(); closing.Kind != tokenOperator || closing.Value != ")" {
+				return nil, p.errorf(closing, "expected ), got %s", closing)
+			}
+			return expr, nil
+		}
+	}
+
+	return nil, p.errorf(t, "expected a value, got %s", t)
+}
+
+func (p *conditionalParser) call(name conditionalToken) (conditionalExpr, error) {
+	arity, ok := conditionalFunctions[name.Value]
+	if !ok {
+		return nil, p.errorf(name, "unknown function %s", name.Value)
+	}
+	p.next()
+
+	call := &conditionalCall{Name: name.Value}
+	for !p.isOperator(")") {
+		if len(call.Args) > 0 {
+			if t := p.next(); t.Kind != tokenOperator || t.Value != "," {
+				return nil, p.errorf(t, "expected , or ), got %s", t)
+			}
+		}
+		arg, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		call.Args = append(call.Args, arg)
+	}
+	p.next()
+
+	if len(call.Args) != arity {
+		return nil, p.errorf(name, "%s takes %d argument(s), got %d", name.Value, arity, len(call.Args))
+	}
+	return call, nil
+}
+
+func validateConditional(v interface{}, k string) ([]string, []error) {
+	s := v.(string)
+	if s == "" {
+		return nil, nil
+	}
+	if _, err := parseConditional(s); err != nil {
+		return nil, []error{fmt.Errorf("%s: %s", k, err)}
+	}
+	return nil, nil
+}
@@ -0,0 +1,56 @@
+package buildkite
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseConditional(t *testing.T) {
+	for expression, expected := range map[string]string{
+		`build.branch == "main"`:                                                           `(build.branch == "main")`,
+		`build.branch == 'main' && build.message !~ /skip/`:                                `((build.branch == "main") && (build.message !~ /skip/))`,
+		`build.tag =~ /^v\d+\.\d+$/i || build.branch == pipeline.default_branch`:           `((build.tag =~ /(?i)^v\d+\.\d+$/) || (build.branch == pipeline.default_branch))`,
+		`!build.pull_request.draft && build.pull_request.id != null`:                       `(!build.pull_request.draft && (build.pull_request.id != null))`,
+		`build.pull_request.labels includes "deploy"`:                                      `(build.pull_request.labels includes "deploy")`,
+		`build.env("DEPLOY") == "true" && (build.source == "ui" || build.source == "api")`: `((build.env("DEPLOY") == "true") && ((build.source == "ui") || (build.source == "api")))`,
+		`build.message =~ /path\/to/`:                                                      `(build.message =~ /path\/to/)`,
+		`build.number == 1 || build.branch != "a\"b"`:                                      `((build.number == 1) || (build.branch != "a\"b"))`,
+		`!build.pull_request.draft == true`:                                                `(!build.pull_request.draft == true)`,
+		`!(build.branch == "main")`:                                                        `!(build.branch == "main")`,
+		`!!build.pull_request.draft`:                                                       `!!build.pull_request.draft`,
+	} {
+		expr, err := parseConditional(expression)
+		if err != nil {
+			t.Errorf("%s: %s", expression, err)
+			continue
+		}
+		if actual := expr.String(); actual != expected {
+			t.Errorf("%s: got %s, want %s", expression, actual, expected)
+		}
+	}
+}
+
+func TestParseConditional_errors(t *testing.T) {
+	for expression, expected := range map[string]string{
+		``:                                  `column 1: the expression is empty`,
+		`build.branc == "main"`:             `column 1: unknown variable build.branc, did you mean build.branch?`,
+		`build.branch = "main"`:             `column 14: unexpected "="`,
+		`build.branch == "main`:             `column 17: string is missing its closing "`,
+		`build.branch == "main" &&`:         `column 26: expected a value, got the end of the expression`,
+		`build.branch == "main" build.tag`:  `column 24: expected an operator, got "build.tag"`,
+		`build.message =~ "skip"`:           `column 18: =~ needs a regular expression such as /^main$/, got "skip"`,
+		`build.message == /skip/`:           `column 18: regular expressions can only be used with =~ and !~`,
+		`build.message =~ /(skip/`:          `column 18: invalid regular expression`,
+		`build.message !~ /skip`:            `column 18: regular expression is missing its closing /`,
+		`(build.branch == "main"`:           `column 24: expected ), got the end of the expression`,
+		`build.env() == "x"`:                `column 1: build.env takes 1 argument(s), got 0`,
+		`build.shell("ls")`:                 `column 1: unknown function build.shell`,
+		`build.branch includes "main"`:      `column 1: includes needs a list such as build.pull_request.labels on its left`,
+		`build.branch == "main" ; rm -rf /`: `column 24: unexpected ";"`,
+	} {
+		_, err := parseConditional(expression)
+		if err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected error %q, got %v", expression, expected, err)
+		}
+	}
+}
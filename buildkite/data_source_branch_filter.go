@@ -0,0 +1,76 @@
+package buildkite
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// dataSourceBranchFilter matches branch names against a branch filter, so
+// filters can be checked, e.g. with outputs or preconditions, before they are
+// used by a pipeline.
+func dataSourceBranchFilter() *schema.Resource {
+	return &schema.Resource{
+		Read: ReadBranchFilter,
+
+		Schema: map[string]*schema.Schema{
+			"pattern": &schema.Schema{
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validateBranchFilter,
+			},
+			"branches": &schema.Schema{
+				Type:     schema.TypeList,
+				Required: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"matches": &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeBool,
+				},
+			},
+			"matching_branches": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+		},
+	}
+}
+
+func ReadBranchFilter(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[TRACE] ReadBranchFilter")
+
+	pattern := d.Get("pattern").(string)
+	filter, err := parseBranchFilter(pattern)
+	if err != nil {
+		return fmt.Errorf("invalid branch filter: %s", err)
+	}
+
+	branchesI := d.Get("branches").([]interface{})
+	branches := make([]string, len(branchesI))
+	matches := make(map[string]interface{}, len(branchesI))
+	matching := []string{}
+	for i, branchI := range branchesI {
+		branches[i], _ = branchI.(string)
+		match := filter.Match(branches[i])
+		matches[branches[i]] = match
+		if match {
+			matching = append(matching, branches[i])
+		}
+	}
+
+	id := pattern + "\n" + strings.Join(branches, "\n")
+	d.SetId(fmt.Sprintf("%x", sha256.Sum256([]byte(id))))
+	d.Set("matches", matches)
+	return d.Set("matching_branches", matching)
+}
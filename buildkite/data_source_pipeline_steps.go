@@ -0,0 +1,49 @@
+package buildkite
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// dataSourcePipelineSteps renders step definitions into a pipeline YAML
+// document without managing a pipeline, e.g. for dynamic pipeline uploads.
+func dataSourcePipelineSteps() *schema.Resource {
+	return &schema.Resource{
+		Read: ReadPipelineSteps,
+
+		Schema: map[string]*schema.Schema{
+			"env": &schema.Schema{
+				Type:     schema.TypeMap,
+				Optional: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"notify": notifySchema(),
+			"step": &schema.Schema{
+				Type:     schema.TypeList,
+				Required: true,
+				Elem:     stepResource(false),
+			},
+			"rendered_configuration": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func ReadPipelineSteps(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[TRACE] ReadPipelineSteps")
+
+	rendered, err := renderedConfiguration(d.Get)
+	if err != nil {
+		return err
+	}
+
+	d.SetId(fmt.Sprintf("%x", sha256.Sum256([]byte(rendered))))
+	return d.Set("rendered_configuration", rendered)
+}
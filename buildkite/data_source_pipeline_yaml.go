@@ -0,0 +1,68 @@
+package buildkite
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"log"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// dataSourcePipelineYAML parses a pipeline YAML document into the step
+// model, e.g. to migrate a .buildkite/pipeline.yml to step blocks or to
+// validate a document before it is uploaded.
+func dataSourcePipelineYAML() *schema.Resource {
+	return &schema.Resource{
+		Read: ReadPipelineYAML,
+
+		Schema: map[string]*schema.Schema{
+			"configuration": &schema.Schema{
+				Type:     schema.TypeString,
+				Required: true,
+			},
+			"env": &schema.Schema{
+				Type:     schema.TypeMap,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+			"notify": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     notifySchema().Elem,
+			},
+			"step": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     stepResource(false),
+			},
+			"warnings": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem: &schema.Schema{
+					Type: schema.TypeString,
+				},
+			},
+		},
+	}
+}
+
+func ReadPipelineYAML(d *schema.ResourceData, meta interface{}) error {
+	log.Printf("[TRACE] ReadPipelineYAML")
+
+	configuration := d.Get("configuration").(string)
+	doc, err := parsePipelineYAML(configuration)
+	if err != nil {
+		return fmt.Errorf("invalid pipeline YAML: %s", err)
+	}
+	for _, warning := range doc.Warnings {
+		log.Printf("[WARN] buildkite: pipeline YAML %s", warning)
+	}
+
+	d.SetId(fmt.Sprintf("%x", sha256.Sum256([]byte(configuration))))
+	d.Set("env", doc.Env)
+	d.Set("notify", flattenNotifications(doc.Notify))
+	d.Set("warnings", doc.Warnings)
+	return d.Set("step", flattenSteps(doc.Steps, nil, "", false))
+}
@@ -0,0 +1,440 @@
+package buildkite
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	yaml "gopkg.in/yaml.v3"
+)
+
+// jsonSchema is the subset of JSON schema (draft 7) used by the Buildkite
+// pipeline schema.
+type jsonSchema struct {
+	Ref                  string                 `json:"$ref"`
+	Type                 schemaTypes            `json:"type"`
+	Enum                 []interface{}          `json:"enum"`
+	Properties           map[string]*jsonSchema `json:"properties"`
+	AdditionalProperties json.RawMessage        `json:"additionalProperties"`
+	Required             []string               `json:"required"`
+	Items                *jsonSchema            `json:"items"`
+	AnyOf                []*jsonSchema          `json:"anyOf"`
+	Minimum              *float64               `json:"minimum"`
+	Maximum              *float64               `json:"maximum"`
+	MinItems             *int                   `json:"minItems"`
+	Definitions          map[string]*jsonSchema `json:"definitions"`
+
+	// closed is set when additionalProperties is false, additional when it
+	// is a schema.
+	closed     bool
+	additional *jsonSchema
+}
+
+// schemaTypes is the type keyword, which is either a single type or a list.
+type schemaTypes []string
+
+func (t *schemaTypes) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*t = schemaTypes{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*t = list
+	return nil
+}
+
+func (s *jsonSchema) compile() error {
+	if s == nil {
+		return nil
+	}
+
+	if len(s.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(s.AdditionalProperties, &allowed); err == nil {
+			s.closed = !allowed
+		} else {
+			s.additional = &jsonSchema{}
+			if err := json.Unmarshal(s.AdditionalProperties, s.additional); err != nil {
+				return err
+			}
+		}
+	}
+
+	children := []*jsonSchema{s.Items, s.additional}
+	children = append(children, s.AnyOf...)
+	for _, child := range s.Properties {
+		children = append(children, child)
+	}
+	for _, child := range s.Definitions {
+		children = append(children, child)
+	}
+	for _, child := range children {
+		if err := child.compile(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+var pipelineSchema = mustLoadSchema(pipelineSchemaJSON)
+
+func mustLoadSchema(src string) *jsonSchema {
+	s := &jsonSchema{}
+	if err := json.Unmarshal([]byte(src), s); err != nil {
+		panic(fmt.Sprintf("buildkite: invalid pipeline schema: %s", err))
+	}
+	if err := s.compile(); err != nil {
+		panic(fmt.Sprintf("buildkite: invalid pipeline schema: %s", err))
+	}
+	return s
+}
+
+// schemaViolation is a value in a YAML document which does not match the
+// schema. Unknown keys are reported separately, as whether they are errors
+// is up to the user.
+type schemaViolation struct {
+	Path       string
+	Line       int
+	Column     int
+	Message    string
+	UnknownKey bool
+}
+
+func (v schemaViolation) Error() string {
+	if v.Path == "" {
+		return fmt.Sprintf("line %d, column %d: %s", v.Line, v.Column, v.Message)
+	}
+	return fmt.Sprintf("line %d, column %d: %s: %s", v.Line, v.Column, v.Path, v.Message)
+}
+
+func countUnknownKeys(violations []schemaViolation) (unknown, other int) {
+	for _, v := range violations {
+		if v.UnknownKey {
+			unknown++
+		} else {
+			other++
+		}
+	}
+	return unknown, other
+}
+
+// validatePipelineSchema validates a pipeline YAML document against the
+// bundled Buildkite pipeline schema. It works offline, on the YAML nodes
+// themselves so violations carry their position.
+func validatePipelineSchema(src string) ([]schemaViolation, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return nil, fmt.Errorf("pipeline YAML is empty")
+	}
+
+	v := &schemaValidator{root: pipelineSchema}
+	return v.validate(pipelineSchema, root.Content[0], ""), nil
+}
+
+type schemaValidator struct {
+	root *jsonSchema
+}
+
+func (v *schemaValidator) resolve(s *jsonSchema) *jsonSchema {
+	for s.Ref != "" {
+		name := strings.TrimPrefix(s.Ref, "#/definitions/")
+		def, ok := v.root.Definitions[name]
+		if !ok {
+			panic(fmt.Sprintf("buildkite: unknown pipeline schema reference %q", s.Ref))
+		}
+		s = def
+	}
+	return s
+}
+
+func (v *schemaValidator) validate(s *jsonSchema, node *yaml.Node, path string) []schemaViolation {
+	s = v.resolve(s)
+	node = resolveYAMLAlias(node)
+
+	violation := func(n *yaml.Node, format string, args ...interface{}) schemaViolation {
+		return schemaViolation{Path: path, Line: n.Line, Column: n.Column, Message: fmt.Sprintf(format, args...)}
+	}
+
+	actual := yamlNodeType(node)
+	if len(s.Type) > 0 && !typeMatches(s.Type, actual) {
+		return []schemaViolation{violation(node, "expected %s, got %s", strings.Join(s.Type, " or "), actual)}
+	}
+
+	var violations []schemaViolation
+
+	if len(s.Enum) > 0 && !enumContains(s.Enum, node) {
+		allowed := make([]string, len(s.Enum))
+		for i, e := range s.Enum {
+			allowed[i] = fmt.Sprintf("%v", e)
+		}
+		violations = append(violations, violation(node, "must be one of %s, got %q", strings.Join(allowed, ", "), node.Value))
+	}
+
+	if (s.Minimum != nil || s.Maximum != nil) && (actual == "integer" || actual == "number") {
+		var f float64
+		if err := node.Decode(&f); err == nil {
+			if s.Minimum != nil && f < *s.Minimum {
+				violations = append(violations, violation(node, "must be at least %v, got %v", *s.Minimum, f))
+			}
+			if s.Maximum != nil && f > *s.Maximum {
+				violations = append(violations, violation(node, "must be at most %v, got %v", *s.Maximum, f))
+			}
+		}
+	}
+
+	switch node.Kind {
+	case yaml.MappingNode:
+		keys, values := yamlMappingPairs(node)
+		present := map[string]bool{}
+		for _, key := range keys {
+			present[key.Value] = true
+		}
+		for _, required := range s.Required {
+			if !present[required] {
+				violations = append(violations, violation(node, "%s is required", required))
+			}
+		}
+		for i, key := range keys {
+			keyPath := joinSchemaPath(path, key.Value)
+			if prop, ok := s.Properties[key.Value]; ok {
+				violations = append(violations, v.validate(prop, values[i], keyPath)...)
+			} else if s.additional != nil {
+				violations = append(violations, v.validate(s.additional, values[i], keyPath)...)
+			} else if s.closed {
+				message := fmt.Sprintf("unknown key %q", key.Value)
+				names := make([]string, 0, len(s.Properties))
+				for name := range s.Properties {
+					names = append(names, name)
+				}
+				if suggestion := suggestKey(key.Value, names); suggestion != "" {
+					message += fmt.Sprintf(", did you mean %q?", suggestion)
+				}
+				violations = append(violations, schemaViolation{
+					Path:       path,
+					Line:       key.Line,
+					Column:     key.Column,
+					Message:    message,
+					UnknownKey: true,
+				})
+			}
+		}
+	case yaml.SequenceNode:
+		if s.MinItems != nil && len(node.Content) < *s.MinItems {
+			violations = append(violations, violation(node, "must have at least %d items", *s.MinItems))
+		}
+		if s.Items != nil {
+			for i, item := range node.Content {
+				violations = append(violations, v.validate(s.Items, item, joinSchemaPath(path, fmt.Sprintf("%d", i)))...)
+			}
+		}
+	}
+
+	if len(s.AnyOf) > 0 {
+		violations = append(violations, v.validateAnyOf(s.AnyOf, node, path)...)
+	}
+
+	return violations
+}
+
+// validateAnyOf reports the violations of the alternative which matches best.
+// Alternatives which only have unknown keys match. Otherwise alternatives of
+// the right type win, then those knowing the most of the keys in use, so e.g.
+// a command step with a typo is reported as a command step.
+func (v *schemaValidator) validateAnyOf(alternatives []*jsonSchema, node *yaml.Node, path string) []schemaViolation {
+	actual := yamlNodeType(node)
+
+	var best []schemaViolation
+	bestRank, bestUnknown, bestOther := -1, 0, 0
+	var types []string
+
+	for _, alternative := range alternatives {
+		violations := v.validate(alternative, node, path)
+		unknown, other := countUnknownKeys(violations)
+
+		rank := 1
+		if resolved := v.resolve(alternative); len(resolved.Type) > 0 && !typeMatches(resolved.Type, actual) {
+			rank = 0
+			types = append(types, resolved.Type...)
+		} else if other == 0 {
+			rank = 2
+		}
+
+		better := rank > bestRank ||
+			rank == bestRank && (unknown < bestUnknown || unknown == bestUnknown && other < bestOther)
+		if better {
+			best, bestRank, bestUnknown, bestOther = violations, rank, unknown, other
+		}
+	}
+
+	if bestRank == 0 {
+		return []schemaViolation{{
+			Path:    path,
+			Line:    node.Line,
+			Column:  node.Column,
+			Message: fmt.Sprintf("expected %s, got %s", strings.Join(uniqueStrings(types), " or "), actual),
+		}}
+	}
+	return best
+}
+
+func joinSchemaPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// yamlNodeType returns the JSON schema type of a YAML node.
+func yamlNodeType(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "object"
+	case yaml.SequenceNode:
+		return "array"
+	}
+	switch node.ShortTag() {
+	case "!!null":
+		return "null"
+	case "!!bool":
+		return "boolean"
+	case "!!int":
+		return "integer"
+	case "!!float":
+		return "number"
+	}
+	return "string"
+}
+
+func typeMatches(types []string, actual string) bool {
+	for _, t := range types {
+		if t == actual || t == "number" && actual == "integer" {
+			return true
+		}
+	}
+	return false
+}
+
+func enumContains(enum []interface{}, node *yaml.Node) bool {
+	if node.Kind != yaml.ScalarNode {
+		return false
+	}
+	for _, e := range enum {
+		if fmt.Sprintf("%v", e) == node.Value {
+			return true
+		}
+	}
+	return false
+}
+
+// suggestKey returns the known name closest to an unknown one, if it is
+// likely to be a typo.
+func suggestKey(key string, names []string) string {
+	names = append([]string{}, names...)
+	sort.Strings(names)
+
+	best, bestDistance := "", 3
+	for _, name := range names {
+		if d := levenshtein(key, name); d < bestDistance {
+			best, bestDistance = name, d
+		}
+	}
+	return best
+}
+
+func levenshtein(a, b string) int {
+	prev := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		cur := make([]int, len(b)+1)
+		cur[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			cur[j] = minInt(minInt(prev[j]+1, cur[j-1]+1), prev[j-1]+cost)
+		}
+		prev = cur
+	}
+	return prev[len(b)]
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+func uniqueStrings(l []string) []string {
+	out := []string{}
+	for _, s := range l {
+		if !containsString(out, s) {
+			out = append(out, s)
+		}
+	}
+	return out
+}
+
+// resolveYAMLAlias returns the node an alias such as *defaults refers to.
+func resolveYAMLAlias(node *yaml.Node) *yaml.Node {
+	for node.Kind == yaml.AliasNode && node.Alias != nil {
+		node = node.Alias
+	}
+	return node
+}
+
+// yamlMappingPairs returns the keys and values of a mapping, with merge keys
+// such as <<: *defaults expanded. Keys set explicitly win over merged ones.
+func yamlMappingPairs(node *yaml.Node) (keys, values []*yaml.Node) {
+	index := map[string]int{}
+	set := func(key, value *yaml.Node) {
+		if i, ok := index[key.Value]; ok {
+			keys[i], values[i] = key, value
+			return
+		}
+		index[key.Value] = len(keys)
+		keys = append(keys, key)
+		values = append(values, value)
+	}
+
+	var merged [][2]*yaml.Node
+	var explicit [][2]*yaml.Node
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		key, value := node.Content[i], node.Content[i+1]
+		if key.ShortTag() != "!!merge" {
+			explicit = append(explicit, [2]*yaml.Node{key, value})
+			continue
+		}
+
+		sources := []*yaml.Node{resolveYAMLAlias(value)}
+		if sources[0].Kind == yaml.SequenceNode {
+			sources = sources[0].Content
+		}
+		for _, source := range sources {
+			source = resolveYAMLAlias(source)
+			if source.Kind != yaml.MappingNode {
+				continue
+			}
+			sourceKeys, sourceValues := yamlMappingPairs(source)
+			for j := range sourceKeys {
+				merged = append(merged, [2]*yaml.Node{sourceKeys[j], sourceValues[j]})
+			}
+		}
+	}
+
+	for _, pair := range append(merged, explicit...) {
+		set(pair[0], pair[1])
+	}
+	return keys, values
+}
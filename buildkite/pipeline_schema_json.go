@@ -0,0 +1,591 @@
+package buildkite
+
+// pipelineSchemaJSON is a copy of the Buildkite pipeline JSON schema, as
+// published at https://github.com/buildkite/pipeline-schema, limited to the
+// keywords validatePipelineSchema understands. Descriptions are dropped to
+// keep it short. The top level is left open as it is commonly used to hold
+// YAML anchors.
+const pipelineSchemaJSON = `{
+  "$schema": "http://json-schema.org/draft-07/schema#",
+  "anyOf": [
+    {
+      "type": "object",
+      "required": ["steps"],
+      "properties": {
+        "env": { "$ref": "#/definitions/env" },
+        "agents": { "$ref": "#/definitions/agents" },
+        "notify": { "$ref": "#/definitions/buildNotify" },
+        "steps": { "$ref": "#/definitions/pipelineSteps" }
+      }
+    },
+    { "$ref": "#/definitions/pipelineSteps" }
+  ],
+  "definitions": {
+    "allowDependencyFailure": { "type": "boolean" },
+    "agents": {
+      "anyOf": [
+        {
+          "type": "object",
+          "additionalProperties": { "type": ["string", "number", "boolean"] }
+        },
+        {
+          "type": "array",
+          "items": { "type": "string" }
+        }
+      ]
+    },
+    "branches": {
+      "anyOf": [
+        { "type": "string" },
+        { "type": "array", "items": { "type": "string" } }
+      ]
+    },
+    "cache": {
+      "anyOf": [
+        { "type": "string" },
+        { "type": "array", "items": { "type": "string" } },
+        {
+          "type": "object",
+          "required": ["paths"],
+          "properties": {
+            "paths": {
+              "anyOf": [
+                { "type": "string" },
+                { "type": "array", "items": { "type": "string" } }
+              ]
+            },
+            "name": { "type": "string" },
+            "size": { "type": "string" }
+          },
+          "additionalProperties": false
+        }
+      ]
+    },
+    "dependsOn": {
+      "anyOf": [
+        { "type": "null" },
+        { "type": "string" },
+        {
+          "type": "array",
+          "items": {
+            "anyOf": [
+              { "type": "string" },
+              {
+                "type": "object",
+                "properties": {
+                  "step": { "type": "string" },
+                  "allow_failure": { "type": "boolean" }
+                },
+                "additionalProperties": false
+              }
+            ]
+          }
+        }
+      ]
+    },
+    "env": {
+      "type": "object",
+      "additionalProperties": { "type": ["string", "number", "boolean"] }
+    },
+    "fields": {
+      "type": "array",
+      "items": {
+        "anyOf": [
+          { "$ref": "#/definitions/textField" },
+          { "$ref": "#/definitions/selectField" }
+        ]
+      }
+    },
+    "textField": {
+      "type": "object",
+      "required": ["text", "key"],
+      "properties": {
+        "text": { "type": "string" },
+        "key": { "type": "string" },
+        "hint": { "type": "string" },
+        "required": { "type": "boolean" },
+        "default": { "type": "string" }
+      },
+      "additionalProperties": false
+    },
+    "selectField": {
+      "type": "object",
+      "required": ["select", "key", "options"],
+      "properties": {
+        "select": { "type": "string" },
+        "key": { "type": "string" },
+        "hint": { "type": "string" },
+        "required": { "type": "boolean" },
+        "default": {
+          "anyOf": [
+            { "type": "string" },
+            { "type": "array", "items": { "type": "string" } }
+          ]
+        },
+        "multiple": { "type": "boolean" },
+        "options": {
+          "type": "array",
+          "minItems": 1,
+          "items": {
+            "type": "object",
+            "required": ["label", "value"],
+            "properties": {
+              "label": { "type": "string" },
+              "value": { "type": "string" },
+              "hint": { "type": "string" },
+              "required": { "type": "boolean" }
+            },
+            "additionalProperties": false
+          }
+        }
+      },
+      "additionalProperties": false
+    },
+    "identifier": { "type": "string" },
+    "if": { "type": "string" },
+    "key": { "type": "string" },
+    "label": { "type": "string" },
+    "matrix": {
+      "anyOf": [
+        { "$ref": "#/definitions/matrixElementList" },
+        {
+          "type": "object",
+          "required": ["setup"],
+          "properties": {
+            "setup": {
+              "anyOf": [
+                { "$ref": "#/definitions/matrixElementList" },
+                {
+                  "type": "object",
+                  "additionalProperties": { "$ref": "#/definitions/matrixElementList" }
+                }
+              ]
+            },
+            "adjustments": {
+              "type": "array",
+              "items": {
+                "type": "object",
+                "required": ["with"],
+                "properties": {
+                  "with": {
+                    "anyOf": [
+                      { "$ref": "#/definitions/matrixElementList" },
+                      {
+                        "type": "object",
+                        "additionalProperties": { "$ref": "#/definitions/matrixElement" }
+                      }
+                    ]
+                  },
+                  "skip": { "$ref": "#/definitions/skip" },
+                  "soft_fail": { "$ref": "#/definitions/softFail" }
+                },
+                "additionalProperties": false
+              }
+            }
+          },
+          "additionalProperties": false
+        }
+      ]
+    },
+    "matrixElement": { "type": ["string", "integer", "boolean"] },
+    "matrixElementList": {
+      "type": "array",
+      "items": { "$ref": "#/definitions/matrixElement" }
+    },
+    "buildNotify": {
+      "type": "array",
+      "items": {
+        "anyOf": [
+          { "type": "string", "enum": ["github_check", "github_commit_status"] },
+          { "$ref": "#/definitions/notifyEmail" },
+          { "$ref": "#/definitions/notifyBasecamp" },
+          { "$ref": "#/definitions/notifySlack" },
+          { "$ref": "#/definitions/notifyWebhook" },
+          { "$ref": "#/definitions/notifyPagerduty" },
+          { "$ref": "#/definitions/notifyGithubCommitStatus" },
+          { "$ref": "#/definitions/notifyGithubCheck" }
+        ]
+      }
+    },
+    "stepNotify": {
+      "type": "array",
+      "items": {
+        "anyOf": [
+          { "type": "string", "enum": ["github_check", "github_commit_status"] },
+          { "$ref": "#/definitions/notifyBasecamp" },
+          { "$ref": "#/definitions/notifySlack" },
+          { "$ref": "#/definitions/notifyGithubCommitStatus" },
+          { "$ref": "#/definitions/notifyGithubCheck" }
+        ]
+      }
+    },
+    "notifyEmail": {
+      "type": "object",
+      "required": ["email"],
+      "properties": {
+        "email": { "type": "string" },
+        "if": { "$ref": "#/definitions/if" }
+      },
+      "additionalProperties": false
+    },
+    "notifyBasecamp": {
+      "type": "object",
+      "required": ["basecamp_campfire"],
+      "properties": {
+        "basecamp_campfire": { "type": "string" },
+        "if": { "$ref": "#/definitions/if" }
+      },
+      "additionalProperties": false
+    },
+    "notifySlack": {
+      "type": "object",
+      "required": ["slack"],
+      "properties": {
+        "slack": {
+          "anyOf": [
+            { "type": "string" },
+            {
+              "type": "object",
+              "properties": {
+                "channels": { "type": "array", "items": { "type": "string" } },
+                "message": { "type": "string" }
+              },
+              "additionalProperties": false
+            }
+          ]
+        },
+        "if": { "$ref": "#/definitions/if" }
+      },
+      "additionalProperties": false
+    },
+    "notifyWebhook": {
+      "type": "object",
+      "required": ["webhook"],
+      "properties": {
+        "webhook": { "type": "string" },
+        "if": { "$ref": "#/definitions/if" }
+      },
+      "additionalProperties": false
+    },
+    "notifyPagerduty": {
+      "type": "object",
+      "required": ["pagerduty_change_event"],
+      "properties": {
+        "pagerduty_change_event": { "type": "string" },
+        "if": { "$ref": "#/definitions/if" }
+      },
+      "additionalProperties": false
+    },
+    "notifyGithubCommitStatus": {
+      "type": "object",
+      "required": ["github_commit_status"],
+      "properties": {
+        "github_commit_status": {
+          "type": "object",
+          "properties": {
+            "context": { "type": "string" }
+          },
+          "additionalProperties": false
+        },
+        "if": { "$ref": "#/definitions/if" }
+      },
+      "additionalProperties": false
+    },
+    "notifyGithubCheck": {
+      "type": "object",
+      "required": ["github_check"],
+      "properties": {
+        "github_check": {
+          "type": "object",
+          "properties": {
+            "context": { "type": "string" }
+          },
+          "additionalProperties": false
+        },
+        "if": { "$ref": "#/definitions/if" }
+      },
+      "additionalProperties": false
+    },
+    "plugins": {
+      "anyOf": [
+        {
+          "type": "array",
+          "items": {
+            "anyOf": [
+              { "type": "string" },
+              { "type": "object" }
+            ]
+          }
+        },
+        { "type": "object" }
+      ]
+    },
+    "prompt": { "type": "string" },
+    "skip": { "type": ["boolean", "string"] },
+    "softFail": {
+      "anyOf": [
+        { "type": "boolean" },
+        {
+          "type": "array",
+          "items": {
+            "type": "object",
+            "properties": {
+              "exit_status": {
+                "anyOf": [
+                  { "type": "string", "enum": ["*"] },
+                  { "type": "integer" }
+                ]
+              }
+            },
+            "additionalProperties": false
+          }
+        }
+      ]
+    },
+    "commandStep": {
+      "type": "object",
+      "anyOf": [
+        { "required": ["command"] },
+        { "required": ["commands"] },
+        { "required": ["plugins"] }
+      ],
+      "properties": {
+        "agents": { "$ref": "#/definitions/agents" },
+        "allow_dependency_failure": { "$ref": "#/definitions/allowDependencyFailure" },
+        "artifact_paths": {
+          "anyOf": [
+            { "type": "string" },
+            { "type": "array", "items": { "type": "string" } }
+          ]
+        },
+        "branches": { "$ref": "#/definitions/branches" },
+        "cache": { "$ref": "#/definitions/cache" },
+        "cancel_on_build_failing": { "type": "boolean" },
+        "command": { "$ref": "#/definitions/commandList" },
+        "commands": { "$ref": "#/definitions/commandList" },
+        "concurrency": { "type": "integer", "minimum": 1 },
+        "concurrency_group": { "type": "string" },
+        "concurrency_method": { "type": "string", "enum": ["ordered", "eager"] },
+        "depends_on": { "$ref": "#/definitions/dependsOn" },
+        "env": { "$ref": "#/definitions/env" },
+        "id": { "$ref": "#/definitions/identifier" },
+        "identifier": { "$ref": "#/definitions/identifier" },
+        "if": { "$ref": "#/definitions/if" },
+        "key": { "$ref": "#/definitions/key" },
+        "label": { "$ref": "#/definitions/label" },
+        "matrix": { "$ref": "#/definitions/matrix" },
+        "name": { "$ref": "#/definitions/label" },
+        "notify": { "$ref": "#/definitions/stepNotify" },
+        "parallelism": { "type": "integer", "minimum": 1 },
+        "plugins": { "$ref": "#/definitions/plugins" },
+        "priority": { "type": "integer" },
+        "retry": {
+          "type": "object",
+          "properties": {
+            "automatic": {
+              "anyOf": [
+                { "type": "boolean" },
+                { "$ref": "#/definitions/automaticRetry" },
+                { "type": "array", "items": { "$ref": "#/definitions/automaticRetry" } }
+              ]
+            },
+            "manual": {
+              "anyOf": [
+                { "type": "boolean" },
+                {
+                  "type": "object",
+                  "properties": {
+                    "allowed": { "type": "boolean" },
+                    "permit_on_passed": { "type": "boolean" },
+                    "reason": { "type": "string" }
+                  },
+                  "additionalProperties": false
+                }
+              ]
+            }
+          },
+          "additionalProperties": false
+        },
+        "signature": { "type": "object" },
+        "skip": { "$ref": "#/definitions/skip" },
+        "soft_fail": { "$ref": "#/definitions/softFail" },
+        "timeout_in_minutes": { "type": "integer", "minimum": 1 },
+        "type": { "type": "string", "enum": ["script", "command", "commands"] }
+      },
+      "additionalProperties": false
+    },
+    "commandList": {
+      "anyOf": [
+        { "type": "string" },
+        { "type": "array", "items": { "type": "string" } }
+      ]
+    },
+    "automaticRetry": {
+      "type": "object",
+      "properties": {
+        "exit_status": {
+          "anyOf": [
+            { "type": "string", "enum": ["*"] },
+            { "type": "integer" },
+            { "type": "array", "items": { "type": "integer" } }
+          ]
+        },
+        "limit": { "type": "integer", "minimum": 1, "maximum": 10 },
+        "signal": { "type": "string" },
+        "signal_reason": { "type": "string" }
+      },
+      "additionalProperties": false
+    },
+    "waitStep": {
+      "type": "object",
+      "anyOf": [
+        { "required": ["wait"] },
+        { "required": ["waiter"] },
+        { "required": ["type"] }
+      ],
+      "properties": {
+        "allow_dependency_failure": { "$ref": "#/definitions/allowDependencyFailure" },
+        "branches": { "$ref": "#/definitions/branches" },
+        "continue_on_failure": { "type": "boolean" },
+        "depends_on": { "$ref": "#/definitions/dependsOn" },
+        "id": { "$ref": "#/definitions/identifier" },
+        "identifier": { "$ref": "#/definitions/identifier" },
+        "if": { "$ref": "#/definitions/if" },
+        "key": { "$ref": "#/definitions/key" },
+        "type": { "type": "string", "enum": ["wait", "waiter"] },
+        "wait": { "type": ["string", "null"] },
+        "waiter": { "type": ["string", "null"] }
+      },
+      "additionalProperties": false
+    },
+    "blockStep": {
+      "type": "object",
+      "anyOf": [
+        { "required": ["block"] },
+        { "required": ["type"] }
+      ],
+      "properties": {
+        "allow_dependency_failure": { "$ref": "#/definitions/allowDependencyFailure" },
+        "block": { "type": "string" },
+        "blocked_state": { "type": "string", "enum": ["passed", "failed", "running"] },
+        "branches": { "$ref": "#/definitions/branches" },
+        "depends_on": { "$ref": "#/definitions/dependsOn" },
+        "fields": { "$ref": "#/definitions/fields" },
+        "id": { "$ref": "#/definitions/identifier" },
+        "identifier": { "$ref": "#/definitions/identifier" },
+        "if": { "$ref": "#/definitions/if" },
+        "key": { "$ref": "#/definitions/key" },
+        "label": { "$ref": "#/definitions/label" },
+        "name": { "$ref": "#/definitions/label" },
+        "prompt": { "$ref": "#/definitions/prompt" },
+        "type": { "type": "string", "enum": ["block", "manual"] }
+      },
+      "additionalProperties": false
+    },
+    "inputStep": {
+      "type": "object",
+      "anyOf": [
+        { "required": ["input"] },
+        { "required": ["type"] }
+      ],
+      "properties": {
+        "allow_dependency_failure": { "$ref": "#/definitions/allowDependencyFailure" },
+        "branches": { "$ref": "#/definitions/branches" },
+        "depends_on": { "$ref": "#/definitions/dependsOn" },
+        "fields": { "$ref": "#/definitions/fields" },
+        "id": { "$ref": "#/definitions/identifier" },
+        "identifier": { "$ref": "#/definitions/identifier" },
+        "if": { "$ref": "#/definitions/if" },
+        "input": { "type": "string" },
+        "key": { "$ref": "#/definitions/key" },
+        "label": { "$ref": "#/definitions/label" },
+        "name": { "$ref": "#/definitions/label" },
+        "prompt": { "$ref": "#/definitions/prompt" },
+        "type": { "type": "string", "enum": ["input"] }
+      },
+      "additionalProperties": false
+    },
+    "triggerStep": {
+      "type": "object",
+      "required": ["trigger"],
+      "properties": {
+        "allow_dependency_failure": { "$ref": "#/definitions/allowDependencyFailure" },
+        "async": { "type": "boolean" },
+        "branches": { "$ref": "#/definitions/branches" },
+        "build": {
+          "type": "object",
+          "properties": {
+            "branch": { "type": "string" },
+            "commit": { "type": "string" },
+            "env": { "$ref": "#/definitions/env" },
+            "message": { "type": "string" },
+            "meta_data": { "type": "object" }
+          },
+          "additionalProperties": false
+        },
+        "depends_on": { "$ref": "#/definitions/dependsOn" },
+        "id": { "$ref": "#/definitions/identifier" },
+        "identifier": { "$ref": "#/definitions/identifier" },
+        "if": { "$ref": "#/definitions/if" },
+        "key": { "$ref": "#/definitions/key" },
+        "label": { "$ref": "#/definitions/label" },
+        "name": { "$ref": "#/definitions/label" },
+        "skip": { "$ref": "#/definitions/skip" },
+        "soft_fail": { "$ref": "#/definitions/softFail" },
+        "trigger": { "type": "string" },
+        "type": { "type": "string", "enum": ["trigger"] }
+      },
+      "additionalProperties": false
+    },
+    "groupStep": {
+      "type": "object",
+      "required": ["group", "steps"],
+      "properties": {
+        "allow_dependency_failure": { "$ref": "#/definitions/allowDependencyFailure" },
+        "depends_on": { "$ref": "#/definitions/dependsOn" },
+        "group": { "type": ["string", "null"] },
+        "id": { "$ref": "#/definitions/identifier" },
+        "identifier": { "$ref": "#/definitions/identifier" },
+        "if": { "$ref": "#/definitions/if" },
+        "key": { "$ref": "#/definitions/key" },
+        "label": { "$ref": "#/definitions/label" },
+        "notify": { "$ref": "#/definitions/buildNotify" },
+        "skip": { "$ref": "#/definitions/skip" },
+        "steps": {
+          "type": "array",
+          "minItems": 1,
+          "items": { "$ref": "#/definitions/groupedStep" }
+        }
+      },
+      "additionalProperties": false
+    },
+    "stringStep": {
+      "type": "string",
+      "enum": ["block", "input", "wait", "waiter"]
+    },
+    "groupedStep": {
+      "anyOf": [
+        { "$ref": "#/definitions/stringStep" },
+        { "$ref": "#/definitions/commandStep" },
+        { "$ref": "#/definitions/waitStep" },
+        { "$ref": "#/definitions/blockStep" },
+        { "$ref": "#/definitions/inputStep" },
+        { "$ref": "#/definitions/triggerStep" }
+      ]
+    },
+    "pipelineSteps": {
+      "type": "array",
+      "items": {
+        "anyOf": [
+          { "$ref": "#/definitions/stringStep" },
+          { "$ref": "#/definitions/commandStep" },
+          { "$ref": "#/definitions/waitStep" },
+          { "$ref": "#/definitions/blockStep" },
+          { "$ref": "#/definitions/inputStep" },
+          { "$ref": "#/definitions/triggerStep" },
+          { "$ref": "#/definitions/groupStep" }
+        ]
+      }
+    }
+  }
+}`
@@ -0,0 +1,161 @@
+package buildkite
+
+import (
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+)
+
+func TestValidatePipelineSchema_valid(t *testing.T) {
+	docs := []string{
+		testPipelineYAML,
+		"- command: make\n- wait\n",
+		`defaults: &defaults
+  agents:
+    queue: build
+  retry:
+    automatic:
+      - exit_status: -1
+        limit: 2
+steps:
+  - <<: *defaults
+    label: build
+    command: make
+    plugins:
+      - docker#v5.9.0:
+          image: golang
+    soft_fail:
+      - exit_status: 1
+  - trigger: deploy
+    build:
+      meta_data:
+        release: "1"
+`,
+	}
+
+	for _, doc := range docs {
+		violations, err := validatePipelineSchema(doc)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(violations) > 0 {
+			t.Errorf("unexpected violations for %q: %v", doc, violations)
+		}
+	}
+}
+
+func TestValidatePipelineSchema_invalid(t *testing.T) {
+	cases := []struct {
+		YAML     string
+		Expected []string
+	}{
+		{
+			YAML: "steps:\n  - label: build\n    comand: make\n",
+			Expected: []string{
+				`line 3, column 5: steps.0: unknown key "comand", did you mean "command"?`,
+				"line 2, column 5: steps.0: command is required",
+			},
+		},
+		{
+			YAML:     "steps:\n  - command: make\n    agents: queue\n",
+			Expected: []string{"line 3, column 13: steps.0.agents: expected object or array, got string"},
+		},
+		{
+			YAML:     "steps:\n  - command: make\n    parallelism: 0\n",
+			Expected: []string{"line 3, column 18: steps.0.parallelism: must be at least 1, got 0"},
+		},
+		{
+			YAML:     "steps:\n  - block: Release\n    blocked_state: stuck\n",
+			Expected: []string{`line 3, column 20: steps.0.blocked_state: must be one of passed, failed, running, got "stuck"`},
+		},
+		{
+			YAML:     "steps:\n  - wait\n  - sleep\n",
+			Expected: []string{`line 3, column 5: steps.1: must be one of block, input, wait, waiter, got "sleep"`},
+		},
+		{
+			YAML:     "env:\n  CI: true\n",
+			Expected: []string{"line 1, column 1: steps is required"},
+		},
+	}
+
+	for _, tc := range cases {
+		violations, err := validatePipelineSchema(tc.YAML)
+		if err != nil {
+			t.Fatal(err)
+		}
+		actual := make([]string, len(violations))
+		for i, v := range violations {
+			actual[i] = v.Error()
+		}
+		if !reflect.DeepEqual(actual, tc.Expected) {
+			t.Errorf("%q:\ngot  %q\nwant %q", tc.YAML, actual, tc.Expected)
+		}
+	}
+}
+
+func TestValidatePipelineConfiguration(t *testing.T) {
+	warnings, errs := validatePipelineConfiguration("steps:\n  - command: make\n    labl: build\n", "configuration")
+	if len(errs) > 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("expected a warning for the unknown key, got %v", warnings)
+	}
+
+	if _, errs := validatePipelineConfiguration("steps:\n  - command: make\n    agents: queue\n", "configuration"); len(errs) != 1 {
+		t.Errorf("expected an error, got %v", errs)
+	}
+}
+
+func TestPipeline_configurationUnknownKeys(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: `
+provider "buildkite" {
+  organization = "test"
+  api_token    = "test"
+}
+
+resource "buildkite_pipeline" "test" {
+  name       = "test"
+  repository = "git@github.com:buildkite/example.git"
+
+  configuration_unknown_keys = "error"
+  configuration              = <<EOF
+steps:
+  - command: make
+    labl: build
+EOF
+}
+`,
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(`unknown key "labl", did you mean "label"\?`),
+			},
+			resource.TestStep{
+				Config: `
+provider "buildkite" {
+  organization = "test"
+  api_token    = "test"
+}
+
+resource "buildkite_pipeline" "test" {
+  name       = "test"
+  repository = "git@github.com:buildkite/example.git"
+
+  configuration = <<EOF
+steps:
+  - command: make
+    labl: build
+EOF
+}
+`,
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
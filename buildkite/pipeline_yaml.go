@@ -0,0 +1,305 @@
+package buildkite
+
+import (
+	"bytes"
+	"encoding/json"
+	"sort"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// renderPipelineYAML renders steps, along with the pipeline level env and
+// notify, as a Buildkite pipeline YAML document as found in a
+// .buildkite/pipeline.yml. Keys are emitted in a fixed order so the output is
+// stable and diffs well.
+func renderPipelineYAML(env map[string]string, notify []Notification, steps []Step) (string, error) {
+	doc := yamlMapSlice{}
+
+	if len(env) > 0 {
+		doc = append(doc, yamlMapItem{Key: "env", Value: sortedStringMap(env)})
+	}
+	if len(notify) > 0 {
+		v, err := toYAMLValue(notify)
+		if err != nil {
+			return "", err
+		}
+		doc = append(doc, yamlMapItem{Key: "notify", Value: v})
+	}
+
+	stepsY, err := renderStepsYAML(steps)
+	if err != nil {
+		return "", err
+	}
+	doc = append(doc, yamlMapItem{Key: "steps", Value: stepsY})
+
+	var out bytes.Buffer
+	enc := yaml.NewEncoder(&out)
+	enc.SetIndent(2)
+	if err := enc.Encode(doc); err != nil {
+		return "", err
+	}
+	if err := enc.Close(); err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+func renderStepsYAML(steps []Step) ([]interface{}, error) {
+	out := make([]interface{}, len(steps))
+	for i, step := range steps {
+		v, err := renderStepYAML(step)
+		if err != nil {
+			return nil, err
+		}
+		out[i] = v
+	}
+	return out, nil
+}
+
+func renderStepYAML(step Step) (interface{}, error) {
+	s := yamlMapSlice{}
+	add := func(key string, value interface{}) {
+		s = append(s, yamlMapItem{Key: key, Value: value})
+	}
+
+	switch step.Type {
+	case "waiter", "wait":
+		if step.Name == "" && step.Key == "" && len(step.DependsOn) == 0 && step.BranchConfiguration == "" && step.If == "" && !step.ContinueOnFailure {
+			return "wait", nil
+		}
+		if step.Name != "" {
+			add("wait", step.Name)
+		} else {
+			add("wait", nil)
+		}
+	case "manual", "block":
+		add("block", step.Name)
+	case "input":
+		add("input", step.Name)
+	case "trigger":
+		add("trigger", step.TriggerProjectSlug)
+		if step.Name != "" {
+			add("label", step.Name)
+		}
+	case stepTypeGroup:
+		label := step.Group
+		if label == "" {
+			label = step.Name
+		}
+		add("group", label)
+	default:
+		if step.Name != "" {
+			add("label", step.Name)
+		}
+	}
+
+	if step.Key != "" {
+		add("key", step.Key)
+	}
+	if len(step.DependsOn) > 0 {
+		add("depends_on", step.DependsOn)
+	}
+	if step.If != "" {
+		add("if", step.If)
+	}
+	if step.Command != "" {
+		add("command", step.Command)
+	}
+	if len(step.Environment) > 0 {
+		add("env", sortedStringMap(step.Environment))
+	}
+	if agents := stepAgents(step); len(agents) > 0 {
+		add("agents", sortedStringMap(agents))
+	}
+	if step.ArtifactPaths != "" {
+		add("artifact_paths", step.ArtifactPaths)
+	}
+	if step.BranchConfiguration != "" {
+		add("branches", step.BranchConfiguration)
+	}
+	if step.Concurrency != 0 {
+		add("concurrency", step.Concurrency)
+	}
+	if step.ConcurrencyGroup != "" {
+		add("concurrency_group", step.ConcurrencyGroup)
+	}
+	if step.ConcurrencyMethod != "" {
+		add("concurrency_method", step.ConcurrencyMethod)
+	}
+	if step.Parallelism != 0 {
+		add("parallelism", step.Parallelism)
+	}
+	if step.Priority != 0 {
+		add("priority", step.Priority)
+	}
+	if step.TimeoutInMinutes != 0 {
+		add("timeout_in_minutes", step.TimeoutInMinutes)
+	}
+	switch step.Skip {
+	case "", "false":
+	case "true":
+		add("skip", true)
+	default:
+		add("skip", string(step.Skip))
+	}
+	if step.CancelOnBuildFailing {
+		add("cancel_on_build_failing", true)
+	}
+	if step.ContinueOnFailure {
+		add("continue_on_failure", true)
+	}
+	if step.Prompt != "" {
+		add("prompt", step.Prompt)
+	}
+	if step.BlockedState != "" {
+		add("blocked_state", step.BlockedState)
+	}
+	if step.TriggerAsync {
+		add("async", true)
+	}
+
+	if step.Type == "trigger" {
+		build := yamlMapSlice{}
+		for _, item := range []yamlMapItem{
+			{Key: "message", Value: step.TriggerMessage},
+			{Key: "commit", Value: step.TriggerCommit},
+			{Key: "branch", Value: step.TriggerBranch},
+		} {
+			if item.Value != "" {
+				build = append(build, item)
+			}
+		}
+		if len(step.TriggerEnv) > 0 {
+			build = append(build, yamlMapItem{Key: "env", Value: sortedStringMap(step.TriggerEnv)})
+		}
+		if len(build) > 0 {
+			add("build", build)
+		}
+	}
+
+	for _, nested := range []struct {
+		key   string
+		value interface{}
+		set   bool
+	}{
+		{"fields", step.Fields, len(step.Fields) > 0},
+		{"cache", step.Cache, step.Cache != nil},
+		{"matrix", step.Matrix, step.Matrix != nil},
+		{"notify", step.Notify, len(step.Notify) > 0},
+	} {
+		if !nested.set {
+			continue
+		}
+		v, err := toYAMLValue(nested.value)
+		if err != nil {
+			return nil, err
+		}
+		add(nested.key, v)
+	}
+
+	for _, name := range extraFieldNames(step.Extra) {
+		var v interface{}
+		if err := json.Unmarshal(step.Extra[name], &v); err != nil {
+			return nil, err
+		}
+		add(name, v)
+	}
+
+	if step.Type == stepTypeGroup {
+		stepsY, err := renderStepsYAML(step.Steps)
+		if err != nil {
+			return nil, err
+		}
+		add("steps", stepsY)
+	}
+
+	return s, nil
+}
+
+// toYAMLValue converts a value to generic maps and lists through its JSON
+// representation, which is what Buildkite's YAML format mirrors.
+func toYAMLValue(v interface{}) (interface{}, error) {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	var out interface{}
+	if err := json.Unmarshal(data, &out); err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+// yamlMapSlice is a YAML mapping which keeps its keys in order.
+type yamlMapSlice []yamlMapItem
+
+type yamlMapItem struct {
+	Key   string
+	Value interface{}
+}
+
+func (s yamlMapSlice) MarshalYAML() (interface{}, error) {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, item := range s {
+		key, value := &yaml.Node{}, &yaml.Node{}
+		if err := key.Encode(item.Key); err != nil {
+			return nil, err
+		}
+		if err := value.Encode(item.Value); err != nil {
+			return nil, err
+		}
+		node.Content = append(node.Content, key, value)
+	}
+	return node, nil
+}
+
+func sortedStringMap(m map[string]string) yamlMapSlice {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	out := make(yamlMapSlice, len(keys))
+	for i, k := range keys {
+		out[i] = yamlMapItem{Key: k, Value: m[k]}
+	}
+	return out
+}
+
+// renderedConfiguration renders the pipeline described by a resource or
+// data source. Pipelines defined by a YAML configuration render as is.
+func renderedConfiguration(get func(string) interface{}) (string, error) {
+	if configuration, _ := get("configuration").(string); configuration != "" {
+		return configuration, nil
+	}
+
+	env := map[string]string{}
+	for k, vI := range get("env").(map[string]interface{}) {
+		env[k] = vI.(string)
+	}
+
+	return renderPipelineYAML(
+		env,
+		expandNotifications(get("notify").([]interface{})),
+		expandSteps(get("step").([]interface{})),
+	)
+}
+
+func customizeDiffRenderedConfiguration(d *schema.ResourceDiff, meta interface{}) error {
+	for _, k := range []string{"configuration", "env", "notify", "step"} {
+		if !d.NewValueKnown(k) {
+			return d.SetNewComputed("rendered_configuration")
+		}
+	}
+
+	rendered, err := renderedConfiguration(d.Get)
+	if err != nil {
+		return err
+	}
+	if rendered != d.Get("rendered_configuration").(string) {
+		return d.SetNew("rendered_configuration", rendered)
+	}
+	return nil
+}
@@ -0,0 +1,498 @@
+package buildkite
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	multierror "github.com/hashicorp/go-multierror"
+	yaml "gopkg.in/yaml.v3"
+)
+
+// pipelineDocument is a pipeline YAML document parsed into the structures
+// used by the step schema.
+type pipelineDocument struct {
+	Env    map[string]string
+	Notify []Notification
+	Steps  []Step
+
+	// Warnings describes keys which were ignored because the step model has
+	// no way to represent them. Unknown step keys are kept in Step.Extra.
+	Warnings []string
+}
+
+// yamlError is a problem at a position in a pipeline YAML document.
+type yamlError struct {
+	Line    int
+	Column  int
+	Message string
+}
+
+func (e *yamlError) Error() string {
+	return fmt.Sprintf("line %d, column %d: %s", e.Line, e.Column, e.Message)
+}
+
+// stepTypeKeys maps the keys which identify a step in pipeline YAML to the
+// step type used by the API.
+var stepTypeKeys = map[string]string{
+	"command":  "script",
+	"commands": "script",
+	"wait":     "waiter",
+	"waiter":   "waiter",
+	"block":    "manual",
+	"manual":   "manual",
+	"input":    "input",
+	"trigger":  "trigger",
+	"group":    stepTypeGroup,
+}
+
+// pipelineParser walks a YAML node tree, collecting every error rather than
+// stopping at the first so a whole document can be fixed in one go. The
+// yaml.v3 node API is used as it keeps the position of every value.
+type pipelineParser struct {
+	errs     *multierror.Error
+	warnings []string
+}
+
+// parsePipelineYAML parses a pipeline YAML document, which is either a
+// mapping with a steps key or a bare list of steps.
+func parsePipelineYAML(src string) (*pipelineDocument, error) {
+	var root yaml.Node
+	if err := yaml.Unmarshal([]byte(src), &root); err != nil {
+		return nil, err
+	}
+	if len(root.Content) == 0 {
+		return nil, fmt.Errorf("pipeline YAML is empty")
+	}
+
+	p := &pipelineParser{}
+	doc := &pipelineDocument{}
+
+	node := root.Content[0]
+	switch node.Kind {
+	case yaml.SequenceNode:
+		doc.Steps = p.steps(node, false)
+	case yaml.MappingNode:
+		var steps *yaml.Node
+		p.each(node, func(key string, keyNode, value *yaml.Node) {
+			switch key {
+			case "env":
+				doc.Env = p.stringMap(value)
+			case "notify":
+				if p.decode(value, &doc.Notify) {
+					if err := validateNotifications(doc.Notify, false); err != nil {
+						p.errorf(value, "%s", err)
+					}
+				}
+			case "steps":
+				steps = value
+			default:
+				p.warnf(keyNode, "%s is not supported and was ignored", key)
+			}
+		})
+		if steps == nil {
+			p.errorf(node, "steps is required")
+		} else {
+			doc.Steps = p.steps(steps, false)
+		}
+	default:
+		p.errorf(node, "expected a mapping with steps or a list of steps")
+	}
+
+	doc.Warnings = p.warnings
+	if err := p.errs.ErrorOrNil(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (p *pipelineParser) errorf(node *yaml.Node, format string, args ...interface{}) {
+	p.errs = multierror.Append(p.errs, &yamlError{
+		Line:    node.Line,
+		Column:  node.Column,
+		Message: fmt.Sprintf(format, args...),
+	})
+}
+
+func (p *pipelineParser) warnf(node *yaml.Node, format string, args ...interface{}) {
+	p.warnings = append(p.warnings, fmt.Sprintf("line %d, column %d: %s", node.Line, node.Column, fmt.Sprintf(format, args...)))
+}
+
+// each calls fn for every key of a mapping, in document order.
+func (p *pipelineParser) each(node *yaml.Node, fn func(key string, keyNode, value *yaml.Node)) {
+	node = resolveYAMLAlias(node)
+	if node.Kind != yaml.MappingNode {
+		p.errorf(node, "expected a mapping")
+		return
+	}
+	keys, values := yamlMappingPairs(node)
+	for i, key := range keys {
+		fn(key.Value, key, resolveYAMLAlias(values[i]))
+	}
+}
+
+func (p *pipelineParser) steps(node *yaml.Node, nested bool) []Step {
+	node = resolveYAMLAlias(node)
+	if node.Kind != yaml.SequenceNode {
+		p.errorf(node, "steps must be a list")
+		return nil
+	}
+
+	steps := []Step{}
+	for _, stepNode := range node.Content {
+		step, ok := p.step(stepNode)
+		if !ok {
+			continue
+		}
+		if nested && step.Type == stepTypeGroup {
+			p.errorf(stepNode, "group steps cannot be nested in other groups")
+			continue
+		}
+		steps = append(steps, step)
+	}
+	return steps
+}
+
+func (p *pipelineParser) step(node *yaml.Node) (Step, bool) {
+	node = resolveYAMLAlias(node)
+	switch node.Kind {
+	case yaml.ScalarNode:
+		switch stepTypeKeys[node.Value] {
+		case "waiter", "manual", "input":
+			return Step{Type: stepTypeKeys[node.Value]}, true
+		}
+		p.errorf(node, "unknown step %q", node.Value)
+		return Step{}, false
+	case yaml.MappingNode:
+	default:
+		p.errorf(node, "a step must be a mapping")
+		return Step{}, false
+	}
+
+	stepType, ok := p.stepType(node)
+	if !ok {
+		return Step{}, false
+	}
+	step := Step{Type: stepType}
+	var nested *yaml.Node
+
+	p.each(node, func(key string, keyNode, value *yaml.Node) {
+		switch key {
+		case "type":
+			// Already handled by stepType
+		case "command", "commands":
+			step.Command = strings.Join(p.stringList(value), "\n")
+		case "label", "name":
+			step.Name = p.string(value)
+		case "wait", "waiter", "block", "manual", "input":
+			if label := p.string(value); label != "" {
+				step.Name = label
+			}
+		case "group":
+			step.Group = p.string(value)
+		case "trigger":
+			step.TriggerProjectSlug = p.string(value)
+		case "key", "id", "identifier":
+			step.Key = p.string(value)
+		case "depends_on":
+			step.DependsOn = p.dependsOn(value)
+		case "if":
+			step.If = p.string(value)
+			if _, err := parseConditional(step.If); step.If != "" && err != nil {
+				p.errorf(value, "if: %s", err)
+			}
+		case "env":
+			step.Environment = p.stringMap(value)
+		case "agents":
+			step.Agents = p.agents(value)
+		case "artifact_paths":
+			step.ArtifactPaths = strings.Join(p.stringList(value), ";")
+		case "branches":
+			step.BranchConfiguration = strings.Join(p.stringList(value), " ")
+			if _, err := parseBranchFilter(step.BranchConfiguration); err != nil {
+				p.errorf(value, "branches: %s", err)
+			}
+		case "timeout_in_minutes":
+			step.TimeoutInMinutes = p.int(value)
+		case "concurrency":
+			step.Concurrency = p.int(value)
+		case "concurrency_group":
+			step.ConcurrencyGroup = p.string(value)
+		case "concurrency_method":
+			step.ConcurrencyMethod = p.string(value)
+			if step.ConcurrencyMethod != "ordered" && step.ConcurrencyMethod != "eager" {
+				p.errorf(value, "concurrency_method must be ordered or eager, got %q", step.ConcurrencyMethod)
+			}
+		case "parallelism":
+			step.Parallelism = p.int(value)
+		case "priority":
+			step.Priority = p.int(value)
+		case "skip":
+			step.Skip = skipValue(p.string(value))
+		case "cancel_on_build_failing":
+			step.CancelOnBuildFailing = p.bool(value)
+		case "continue_on_failure":
+			step.ContinueOnFailure = p.bool(value)
+		case "prompt":
+			step.Prompt = p.string(value)
+		case "blocked_state":
+			step.BlockedState = p.string(value)
+			if !containsString([]string{"passed", "failed", "running"}, step.BlockedState) {
+				p.errorf(value, "blocked_state must be one of passed, failed or running, got %q", step.BlockedState)
+			}
+		case "fields":
+			step.Fields = p.fields(value)
+		case "async":
+			step.TriggerAsync = p.bool(value)
+		case "build":
+			p.triggerBuild(value, &step)
+		case "cache":
+			step.Cache = &StepCache{}
+			p.decode(value, step.Cache)
+		case "matrix":
+			step.Matrix = &Matrix{}
+			if p.decode(value, step.Matrix) {
+				if err := validateMatrix(step.Matrix); err != nil {
+					p.errorf(value, "matrix: %s", err)
+				}
+			}
+		case "notify":
+			if p.decode(value, &step.Notify) {
+				if err := validateNotifications(step.Notify, true); err != nil {
+					p.errorf(value, "%s", err)
+				}
+			}
+		case "steps":
+			nested = value
+		default:
+			// Kept as is, the same way as fields read from the API
+			var raw json.RawMessage
+			if p.decode(value, &raw) {
+				if step.Extra == nil {
+					step.Extra = map[string]json.RawMessage{}
+				}
+				step.Extra[key] = raw
+			}
+		}
+	})
+
+	if step.Type == stepTypeGroup {
+		if step.Group == "" {
+			step.Group = step.Name
+		}
+		step.Name = ""
+		if nested == nil {
+			p.errorf(node, "a group step must contain steps")
+		} else {
+			step.Steps = p.steps(nested, true)
+		}
+	} else if nested != nil {
+		p.errorf(nested, "only group steps may contain steps")
+	}
+
+	return step, true
+}
+
+// stepType works out the type of a step from the keys it uses, the way the
+// Buildkite agent does, or from an explicit type key.
+func (p *pipelineParser) stepType(node *yaml.Node) (string, bool) {
+	found, stepType := "", ""
+	plugins := false
+
+	keys, values := yamlMappingPairs(node)
+	for i, keyNode := range keys {
+		key, value := keyNode.Value, resolveYAMLAlias(values[i])
+		switch {
+		case key == "type":
+			if value.Value == "script" {
+				return "script", true
+			}
+			if t, ok := stepTypeKeys[value.Value]; ok {
+				return t, true
+			}
+			p.errorf(value, "unknown step type %q", value.Value)
+			return "", false
+		case key == "plugins":
+			plugins = true
+		case stepTypeKeys[key] != "":
+			if stepType != "" && stepTypeKeys[key] != stepType {
+				p.errorf(node, "a step cannot have both %s and %s", found, key)
+				return "", false
+			}
+			found = key
+			stepType = stepTypeKeys[key]
+		}
+	}
+
+	if stepType == "" {
+		if !plugins {
+			p.errorf(node, "unable to determine the step type, expected one of command, wait, block, input, trigger or group")
+			return "", false
+		}
+		// Plugins may make up a command step on their own
+		stepType = "script"
+	}
+	return stepType, true
+}
+
+func (p *pipelineParser) string(node *yaml.Node) string {
+	node = resolveYAMLAlias(node)
+	if node.Kind != yaml.ScalarNode {
+		p.errorf(node, "expected a string")
+		return ""
+	}
+	if node.Tag == "!!null" {
+		return ""
+	}
+	return node.Value
+}
+
+// stringList reads a value given either as a single string or a list.
+func (p *pipelineParser) stringList(node *yaml.Node) []string {
+	node = resolveYAMLAlias(node)
+	if node.Kind != yaml.SequenceNode {
+		if s := p.string(node); s != "" {
+			return []string{s}
+		}
+		return nil
+	}
+
+	l := make([]string, 0, len(node.Content))
+	for _, item := range node.Content {
+		l = append(l, p.string(item))
+	}
+	return l
+}
+
+func (p *pipelineParser) int(node *yaml.Node) int {
+	var i int
+	if node.Kind != yaml.ScalarNode || node.Decode(&i) != nil {
+		p.errorf(node, "expected an integer, got %q", node.Value)
+	}
+	return i
+}
+
+func (p *pipelineParser) bool(node *yaml.Node) bool {
+	var b bool
+	if node.Kind != yaml.ScalarNode || node.Decode(&b) != nil {
+		p.errorf(node, "expected true or false, got %q", node.Value)
+	}
+	return b
+}
+
+func (p *pipelineParser) stringMap(node *yaml.Node) map[string]string {
+	m := map[string]string{}
+	p.each(node, func(key string, keyNode, value *yaml.Node) {
+		m[key] = p.string(value)
+	})
+	return m
+}
+
+// agents reads agent targeting given as a mapping or as a list of key=value
+// rules.
+func (p *pipelineParser) agents(node *yaml.Node) map[string]string {
+	node = resolveYAMLAlias(node)
+	if node.Kind != yaml.SequenceNode {
+		agents := p.stringMap(node)
+		for k, v := range agents {
+			if err := validateAgentTag(k, v); err != nil {
+				p.errorf(node, "agents: %s", err)
+			}
+		}
+		return agents
+	}
+
+	var rules []string
+	for _, item := range node.Content {
+		rule := p.string(item)
+		if _, errs := validateAgentQueryRule(rule, "agents"); len(errs) > 0 {
+			p.errorf(item, "%s", errs[0])
+			continue
+		}
+		rules = append(rules, rule)
+	}
+	return parseAgentQueryRules(rules)
+}
+
+// dependsOn reads step keys given as a string, a list of strings or a list
+// of mappings with a step key.
+func (p *pipelineParser) dependsOn(node *yaml.Node) []string {
+	node = resolveYAMLAlias(node)
+	if node.Kind != yaml.SequenceNode {
+		return p.stringList(node)
+	}
+
+	keys := []string{}
+	for _, item := range node.Content {
+		if item.Kind != yaml.MappingNode {
+			keys = append(keys, p.string(item))
+			continue
+		}
+		p.each(item, func(key string, keyNode, value *yaml.Node) {
+			switch key {
+			case "step":
+				keys = append(keys, p.string(value))
+			default:
+				p.warnf(keyNode, "depends_on.%s is not supported and was ignored", key)
+			}
+		})
+	}
+	return keys
+}
+
+func (p *pipelineParser) fields(node *yaml.Node) []BlockField {
+	node = resolveYAMLAlias(node)
+	if node.Kind != yaml.SequenceNode {
+		p.errorf(node, "fields must be a list")
+		return nil
+	}
+
+	fields := []BlockField{}
+	for _, item := range node.Content {
+		var f BlockField
+		if !p.decode(item, &f) {
+			continue
+		}
+		if f.Key == "" {
+			p.errorf(item, "field key is required")
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func (p *pipelineParser) triggerBuild(node *yaml.Node, step *Step) {
+	p.each(node, func(key string, keyNode, value *yaml.Node) {
+		switch key {
+		case "message":
+			step.TriggerMessage = p.string(value)
+		case "commit":
+			step.TriggerCommit = p.string(value)
+		case "branch":
+			step.TriggerBranch = p.string(value)
+		case "env":
+			step.TriggerEnv = p.stringMap(value)
+		default:
+			p.warnf(keyNode, "build.%s is not supported and was ignored", key)
+		}
+	})
+}
+
+// decode reads a value through its JSON representation, which the API types
+// already know how to read in all of its forms.
+func (p *pipelineParser) decode(node *yaml.Node, v interface{}) bool {
+	var raw interface{}
+	if err := node.Decode(&raw); err != nil {
+		p.errorf(node, "%s", err)
+		return false
+	}
+	data, err := json.Marshal(raw)
+	if err == nil {
+		err = json.Unmarshal(data, v)
+	}
+	if err != nil {
+		p.errorf(node, "%s", err)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,274 @@
+package buildkite
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+const testPipelineYAML = `env:
+  CI: "true"
+steps:
+  - label: ":hammer: Build"
+    key: build
+    commands:
+      - make deps
+      - make
+    agents:
+      queue: build
+    artifact_paths:
+      - "dist/*"
+      - "coverage/*"
+    if: build.branch == "main"
+  - wait: ~
+    continue_on_failure: true
+  - block: ":rocket: Release?"
+    prompt: Ship it?
+    fields:
+      - select: Environment
+        key: env
+        options:
+          - label: Production
+            value: production
+      - text: Notes
+        key: notes
+        required: false
+  - trigger: deploy-app
+    label: Deploy
+    async: true
+    build:
+      branch: main
+      env:
+        RELEASE: "1"
+  - group: Tests
+    depends_on:
+      - step: build
+    steps:
+      - command: make test
+        agents:
+          - queue=test
+      - input
+`
+
+func TestParsePipelineYAML(t *testing.T) {
+	doc, err := parsePipelineYAML(testPipelineYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []Step{
+		{
+			Type:          "script",
+			Name:          ":hammer: Build",
+			Key:           "build",
+			Command:       "make deps\nmake",
+			Agents:        map[string]string{"queue": "build"},
+			ArtifactPaths: "dist/*;coverage/*",
+			If:            `build.branch == "main"`,
+		},
+		{Type: "waiter", ContinueOnFailure: true},
+		{
+			Type:   "manual",
+			Name:   ":rocket: Release?",
+			Prompt: "Ship it?",
+			Fields: []BlockField{
+				{
+					Type:     blockFieldSelect,
+					Key:      "env",
+					Label:    "Environment",
+					Required: true,
+					Options:  []BlockFieldOption{{Label: "Production", Value: "production"}},
+				},
+				{Type: blockFieldText, Key: "notes", Label: "Notes"},
+			},
+		},
+		{
+			Type:               "trigger",
+			Name:               "Deploy",
+			TriggerProjectSlug: "deploy-app",
+			TriggerAsync:       true,
+			TriggerBranch:      "main",
+			TriggerEnv:         map[string]string{"RELEASE": "1"},
+		},
+		{
+			Type:      stepTypeGroup,
+			Group:     "Tests",
+			DependsOn: []string{"build"},
+			Steps: []Step{
+				{Type: "script", Command: "make test", Agents: map[string]string{"queue": "test"}},
+				{Type: "input"},
+			},
+		},
+	}
+
+	if !reflect.DeepEqual(doc.Env, map[string]string{"CI": "true"}) {
+		t.Errorf("unexpected env %#v", doc.Env)
+	}
+	if !reflect.DeepEqual(doc.Steps, expected) {
+		t.Errorf("got:\n%#v\nwant:\n%#v", doc.Steps, expected)
+	}
+	if len(doc.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", doc.Warnings)
+	}
+}
+
+func TestParsePipelineYAML_roundTrip(t *testing.T) {
+	doc, err := parsePipelineYAML(testPipelineYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rendered, err := renderPipelineYAML(doc.Env, doc.Notify, doc.Steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reparsed, err := parsePipelineYAML(rendered)
+	if err != nil {
+		t.Fatalf("rendered YAML does not parse: %s\n%s", err, rendered)
+	}
+	if !reflect.DeepEqual(doc, reparsed) {
+		t.Errorf("got:\n%#v\nwant:\n%#v", reparsed, doc)
+	}
+}
+
+func TestParsePipelineYAML_bareList(t *testing.T) {
+	doc, err := parsePipelineYAML("- command: make\n- wait\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Steps) != 2 || doc.Steps[1].Type != "waiter" {
+		t.Errorf("unexpected steps %#v", doc.Steps)
+	}
+}
+
+func TestParsePipelineYAML_extra(t *testing.T) {
+	doc, err := parsePipelineYAML("steps:\n  - command: make\n    retry:\n      automatic: true\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.Warnings) != 0 {
+		t.Errorf("unexpected warnings: %v", doc.Warnings)
+	}
+	if extra := string(doc.Steps[0].Extra["retry"]); extra != `{"automatic":true}` {
+		t.Errorf("expected retry to be kept, got %q", extra)
+	}
+
+	rendered, err := renderPipelineYAML(nil, nil, doc.Steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "steps:\n  - command: make\n    retry:\n      automatic: true\n"
+	if rendered != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", rendered, expected)
+	}
+}
+
+func TestParsePipelineYAML_warnings(t *testing.T) {
+	doc, err := parsePipelineYAML("image: golang\nsteps:\n  - command: make\n    depends_on:\n      - step: build\n        allow_failure: true\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"line 1, column 1: image is not supported and was ignored",
+		"line 6, column 9: depends_on.allow_failure is not supported and was ignored",
+	}
+	if !reflect.DeepEqual(doc.Warnings, expected) {
+		t.Errorf("got %v, want %v", doc.Warnings, expected)
+	}
+}
+
+func TestParsePipelineYAML_errors(t *testing.T) {
+	cases := []struct {
+		YAML     string
+		Expected []string
+	}{
+		{
+			YAML:     "steps:\n  - label: nothing\n",
+			Expected: []string{"line 2, column 5: unable to determine the step type"},
+		},
+		{
+			YAML:     "steps:\n  - command: make\n    wait: ~\n",
+			Expected: []string{"line 2, column 5: a step cannot have both command and wait"},
+		},
+		{
+			YAML: "steps:\n  - command: make\n    parallelism: lots\n  - sleep\n",
+			Expected: []string{
+				`line 3, column 18: expected an integer, got "lots"`,
+				`line 4, column 5: unknown step "sleep"`,
+			},
+		},
+		{
+			YAML:     "steps:\n  - group: outer\n    steps:\n      - group: inner\n        steps:\n          - wait\n",
+			Expected: []string{"line 4, column 9: group steps cannot be nested in other groups"},
+		},
+		{
+			YAML:     "steps:\n  - group: empty\n",
+			Expected: []string{"line 2, column 5: a group step must contain steps"},
+		},
+		{
+			YAML:     "steps:\n  - command: make\n    agents:\n      - queue\n",
+			Expected: []string{`line 4, column 9: agents: "queue" must be in the form key=value`},
+		},
+		{
+			YAML:     "steps:\n  - command: make\n    branches: [main, \"release/[0-9]\"]\n",
+			Expected: []string{`line 3, column 15: branches: column 6: "release/[0-9]" can't contain '['`},
+		},
+		{
+			YAML:     "steps:\n  - command: make\n    if: build.branch = \"main\"\n",
+			Expected: []string{`line 3, column 9: if: column 14: unexpected "="`},
+		},
+		{
+			YAML:     "env:\n  CI: true\n",
+			Expected: []string{"line 1, column 1: steps is required"},
+		},
+		{
+			YAML:     "steps:\n  - command: make\n   label: x",
+			Expected: []string{"yaml: line"},
+		},
+	}
+
+	for _, tc := range cases {
+		_, err := parsePipelineYAML(tc.YAML)
+		if err == nil {
+			t.Errorf("%q: expected an error", tc.YAML)
+			continue
+		}
+		for _, expected := range tc.Expected {
+			if !strings.Contains(err.Error(), expected) {
+				t.Errorf("%q: expected error to contain %q, got: %s", tc.YAML, expected, err)
+			}
+		}
+	}
+}
+
+func TestReadPipelineYAML(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, dataSourcePipelineYAML().Schema, map[string]interface{}{
+		"configuration": testPipelineYAML,
+	})
+
+	if err := ReadPipelineYAML(d, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	steps := d.Get("step").([]interface{})
+	if len(steps) != 5 {
+		t.Fatalf("expected 5 steps, got %d", len(steps))
+	}
+	if name := d.Get("step.4.name").(string); name != "Tests" {
+		t.Errorf("expected the group label as name, got %q", name)
+	}
+	if key := d.Get("step.2.field.0.key").(string); key != "env" {
+		t.Errorf("expected block field key env, got %q", key)
+	}
+	if queue := d.Get("step.4.step.0.agents.queue").(string); queue != "test" {
+		t.Errorf("expected nested step agents, got %q", queue)
+	}
+
+	// Steps read back from the data source expand into the same API steps
+	if expanded := expandSteps(steps); len(expanded) != 5 || expanded[4].Group != "Tests" {
+		t.Errorf("unexpected expanded steps %#v", expanded)
+	}
+}
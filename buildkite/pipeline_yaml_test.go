@@ -0,0 +1,95 @@
+package buildkite
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestRenderPipelineYAML(t *testing.T) {
+	steps := []Step{
+		{
+			Type:            "script",
+			Name:            ":hammer: Build",
+			Key:             "build",
+			Command:         "make",
+			Environment:     map[string]string{"B": "2", "A": "1"},
+			AgentQueryRules: []string{"queue=build"},
+			Matrix:          &Matrix{Values: []string{"linux", "macos"}},
+		},
+		{Type: "waiter"},
+		{Type: "manual", Name: ":rocket: Release?", BranchConfiguration: "main"},
+		{
+			Type:      stepTypeGroup,
+			Group:     "Deploy",
+			DependsOn: []string{"build"},
+			Steps: []Step{
+				{Type: "script", Command: "make deploy", Skip: "true"},
+			},
+		},
+	}
+	notify := []Notification{{Email: "dev@example.com"}}
+
+	actual, err := renderPipelineYAML(map[string]string{"CI": "true"}, notify, steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `env:
+  CI: "true"
+notify:
+  - email: dev@example.com
+steps:
+  - label: ':hammer: Build'
+    key: build
+    command: make
+    env:
+      A: "1"
+      B: "2"
+    agents:
+      queue: build
+    matrix:
+      - linux
+      - macos
+  - wait
+  - block: ':rocket: Release?'
+    branches: main
+  - group: Deploy
+    depends_on:
+      - build
+    steps:
+      - command: make deploy
+        skip: true
+`
+	if actual != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", actual, expected)
+	}
+
+	if !yamlEquivalent(actual, expected) {
+		t.Errorf("expected rendered YAML to parse")
+	}
+}
+
+func TestReadPipelineSteps(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, dataSourcePipelineSteps().Schema, map[string]interface{}{
+		"step": []interface{}{
+			map[string]interface{}{
+				"type":    "script",
+				"name":    "test",
+				"command": "make test",
+			},
+		},
+	})
+
+	if err := ReadPipelineSteps(d, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "steps:\n  - label: test\n    command: make test\n"
+	if actual := d.Get("rendered_configuration").(string); actual != expected {
+		t.Errorf("got:\n%s\nwant:\n%s", actual, expected)
+	}
+	if d.Id() == "" {
+		t.Errorf("expected an id to be set")
+	}
+}
@@ -13,6 +13,12 @@ func Provider() terraform.ResourceProvider {
 			"buildkite_pipeline": resourcePipeline(),
 		},
 
+		DataSourcesMap: map[string]*schema.Resource{
+			"buildkite_branch_filter":  dataSourceBranchFilter(),
+			"buildkite_pipeline_steps": dataSourcePipelineSteps(),
+			"buildkite_pipeline_yaml":  dataSourcePipelineYAML(),
+		},
+
 		Schema: map[string]*schema.Schema{
 			"organization": &schema.Schema{
 				Type:        schema.TypeString,
@@ -24,6 +30,7 @@ func Provider() terraform.ResourceProvider {
 				Required:    true,
 				DefaultFunc: schema.EnvDefaultFunc("BUILDKITE_API_TOKEN", nil),
 			},
+			"default_tags": tagsSchema(),
 		},
 
 		ConfigureFunc: providerConfigure,
@@ -35,5 +42,10 @@ func providerConfigure(d *schema.ResourceData) (interface{}, error) {
 	apiToken := d.Get("api_token").(string)
 
 	orgURLStr := fmt.Sprintf("https://api.buildkite.com/v2/organizations/%s/", orgName)
-	return NewClient(orgURLStr, apiToken)
+	client, err := NewClient(orgURLStr, apiToken)
+	if err != nil {
+		return nil, err
+	}
+	client.defaultTags = expandTags(d.Get("default_tags"))
+	return client, nil
 }
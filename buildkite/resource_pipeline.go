@@ -4,19 +4,45 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"strings"
+	"time"
 
+	"github.com/hashicorp/terraform/helper/customdiff"
 	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
 )
 
 func resourcePipeline() *schema.Resource {
-	return &schema.Resource{
+	r := &schema.Resource{
 		Create: CreatePipeline,
 		Read:   ReadPipeline,
 		Update: UpdatePipeline,
 		Delete: DeletePipeline,
 		Importer: &schema.ResourceImporter{
-			State: schema.ImportStatePassthrough,
+			State: resourcePipelineImport,
 		},
+		Timeouts: &schema.ResourceTimeout{
+			Delete: schema.DefaultTimeout(10 * time.Minute),
+		},
+		SchemaVersion: 2,
+		CustomizeDiff: customdiff.All(
+			customizeDiffSlug,
+			customizeDiffMatrix,
+			customizeDiffConfiguration,
+			customizeDiffGroups,
+			customizeDiffSteps,
+			customizeDiffAgents,
+			customizeDiffFilters,
+			customizeDiffNotify,
+			customizeDiffConcurrency,
+			customizeDiffTimeouts,
+			customizeDiffProviderSettings,
+			customizeDiffTags,
+			customizeDiffSensitiveEnv,
+			customizeDiffCluster,
+			customizeDiffExtraFields,
+			customizeDiffRenderedConfiguration,
+		),
 
 		Schema: map[string]*schema.Schema{
 			"slug": &schema.Schema{
@@ -24,6 +50,15 @@ func resourcePipeline() *schema.Resource {
 				Computed: true,
 				Optional: true,
 			},
+			"pin_slug": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"graphql_id": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
 			"web_url": &schema.Schema{
 				Type:     schema.TypeString,
 				Computed: true,
@@ -53,12 +88,14 @@ func resourcePipeline() *schema.Resource {
 				Optional: true,
 			},
 			"repository": &schema.Schema{
-				Type:     schema.TypeString,
-				Required: true,
+				Type:         schema.TypeString,
+				Required:     true,
+				ValidateFunc: validateRepository,
 			},
 			"branch_configuration": &schema.Schema{
-				Type:     schema.TypeString,
-				Optional: true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateBranchFilter,
 			},
 			"default_branch": &schema.Schema{
 				Type:     schema.TypeString,
@@ -70,237 +107,172 @@ func resourcePipeline() *schema.Resource {
 				Optional: true,
 			},
 			"skip_queued_branch_builds_filter": &schema.Schema{
-				Type:     schema.TypeString,
-				Optional: true,
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateBranchFilter,
 			},
 			"cancel_running_branch_builds": &schema.Schema{
 				Type:     schema.TypeBool,
 				Optional: true,
 			},
 			"cancel_running_branch_builds_filter": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateBranchFilter,
+			},
+			"default_timeout_in_minutes": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"maximum_timeout_in_minutes": &schema.Schema{
+				Type:         schema.TypeInt,
+				Optional:     true,
+				ValidateFunc: validation.IntAtLeast(0),
+			},
+			"env":           envSchema(),
+			"sensitive_env": sensitiveEnvSchema(),
+			"sensitive_env_salt": &schema.Schema{
+				Type:      schema.TypeString,
+				Computed:  true,
+				Sensitive: true,
+			},
+			"webhook_url": &schema.Schema{
 				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"notify": notifySchema(),
+			"team":   teamSchema(),
+			"tags":   tagsSchema(),
+			"tags_all": &schema.Schema{
+				Type:     schema.TypeSet,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+				Set:      schema.HashString,
+			},
+			"archived": &schema.Schema{
+				Type:     schema.TypeBool,
 				Optional: true,
+				Default:  false,
+			},
+			"deletion_behavior": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "delete",
+				ValidateFunc: validation.StringInSlice([]string{"archive", "delete"}, false),
 			},
-			"env": &schema.Schema{
-				Type:     schema.TypeMap,
+			"deletion_protection": &schema.Schema{
+				Type:     schema.TypeBool,
 				Optional: true,
-				Elem: &schema.Schema{
-					Type: schema.TypeString,
-				},
+				Default:  false,
 			},
-			"webhook_url": &schema.Schema{
+			"cancel_builds_on_destroy": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"running_builds_count": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"scheduled_builds_count": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+			"cluster_id": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"cluster_name": &schema.Schema{
+				Type:     schema.TypeString,
+				Computed: true,
+			},
+			"emoji": &schema.Schema{
+				Type:     schema.TypeString,
+				Optional: true,
+			},
+			"color": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringMatch(colorRegexp, "must be a hex color such as #ff8800"),
+			},
+			"visibility": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Computed:     true,
+				ValidateFunc: validation.StringInSlice([]string{"private", "public"}, false),
+			},
+			"configuration": &schema.Schema{
+				Type:             schema.TypeString,
+				Optional:         true,
+				ConflictsWith:    []string{"step"},
+				ValidateFunc:     validatePipelineConfiguration,
+				DiffSuppressFunc: suppressEquivalentYAML,
+			},
+			"configuration_unknown_keys": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "warn",
+				ValidateFunc: validation.StringInSlice([]string{"warn", "error"}, false),
+			},
+			"rendered_configuration": &schema.Schema{
 				Type:     schema.TypeString,
 				Computed: true,
 			},
 			"step": &schema.Schema{
-				Type:     schema.TypeList,
-				Required: true,
-				Elem: &schema.Resource{
-					Schema: map[string]*schema.Schema{
-						"type": &schema.Schema{
-							Type:     schema.TypeString,
-							Required: true,
-						},
-						"name": &schema.Schema{
-							Type:     schema.TypeString,
-							Optional: true,
-						},
-						"command": &schema.Schema{
-							Type:     schema.TypeString,
-							Optional: true,
-						},
-						"env": &schema.Schema{
-							Type:     schema.TypeMap,
-							Optional: true,
-							Elem: &schema.Schema{
-								Type: schema.TypeString,
-							},
-						},
-						"timeout_in_minutes": &schema.Schema{
-							Type:     schema.TypeInt,
-							Optional: true,
-						},
-						"agent_query_rules": &schema.Schema{
-							Type:     schema.TypeList,
-							Optional: true,
-							Elem: &schema.Schema{
-								Type: schema.TypeString,
-							},
-						},
-						"artifact_paths": &schema.Schema{
-							Type:     schema.TypeString,
-							Optional: true,
-						},
-						"branch_configuration": &schema.Schema{
-							Type:     schema.TypeString,
-							Optional: true,
-						},
-						"concurrency": &schema.Schema{
-							Type:     schema.TypeInt,
-							Optional: true,
-						},
-						"parallelism": &schema.Schema{
-							Type:     schema.TypeInt,
-							Optional: true,
-						},
-					},
-				},
-			},
-			"bitbucket_settings": &schema.Schema{
-				Type:          schema.TypeList,
-				Optional:      true,
-				Computed:      true,
-				MaxItems:      1,
-				ConflictsWith: []string{"github_settings"},
-				Elem: &schema.Resource{
-					Schema: map[string]*schema.Schema{
-						"build_pull_requests": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"pull_request_branch_filter_enabled": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"pull_request_branch_filter_configuration": &schema.Schema{
-							Type:     schema.TypeString,
-							Optional: true,
-						},
-						"skip_pull_request_builds_for_existing_commits": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"build_tags": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"publish_commit_status": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"publish_commit_status_per_step": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"upgraded_to_v2_hooks": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-						},
-					},
-				},
-			},
-			"github_settings": &schema.Schema{
 				Type:          schema.TypeList,
 				Optional:      true,
-				Computed:      true,
-				MaxItems:      1,
-				ConflictsWith: []string{"bitbucket_settings"},
-				Elem: &schema.Resource{
-					Schema: map[string]*schema.Schema{
-						"trigger_mode": &schema.Schema{
-							Type:     schema.TypeString,
-							Optional: true,
-						},
-						"build_pull_requests": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"build_pull_request_ready_for_review": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"cancel_deleted_branch_builds": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"pull_request_branch_filter_enabled": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-						},
-						"pull_request_branch_filter_configuration": &schema.Schema{
-							Type:     schema.TypeString,
-							Optional: true,
-						},
-						"skip_builds_for_existing_commits": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"skip_pull_request_builds_for_existing_commits": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"build_pull_request_forks": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-						},
-						"build_pull_request_labels_changed": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-						},
-						"filter_enabled": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"use_step_key_as_commit_status": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  false,
-						},
-						"prefix_pull_request_fork_branch_names": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"build_branches": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-						},
-						"build_tags": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-						},
-						"publish_commit_status": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-							Default:  true,
-						},
-						"publish_commit_status_per_step": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-						},
-						"publish_blocked_as_pending": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-						},
-						"separate_pull_request_statuses": &schema.Schema{
-							Type:     schema.TypeBool,
-							Optional: true,
-						},
-						"commit_status_404s": &schema.Schema{
-							Type:     schema.TypeInt,
-							Computed: true,
-						},
-					},
-				},
+				ConflictsWith: []string{"configuration"},
+				Elem:          stepResource(false),
+			},
+			// Fields of the pipeline which have no attribute, as a JSON
+			// object. These are read from the API and sent back unchanged.
+			"extra_json": &schema.Schema{
+				Type:             schema.TypeString,
+				Optional:         true,
+				Computed:         true,
+				ValidateFunc:     validateExtraJSON(pipelineJSONFields),
+				DiffSuppressFunc: suppressEquivalentJSON,
+			},
+			"extra_fields": &schema.Schema{
+				Type:     schema.TypeList,
+				Computed: true,
+				Elem:     &schema.Schema{Type: schema.TypeString},
+			},
+			"manage_provider_settings": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				Default:      "changes",
+				ValidateFunc: validation.StringInSlice([]string{"changes", "authoritative"}, false),
 			},
 		},
 	}
+
+	for _, block := range providerSettingsBlocks {
+		r.Schema[block.Attr] = providerSettingsSchema(block.Attr, block.Resource())
+	}
+
+	// Earlier schema versions only lack attributes of the current one, so its
+	// type can decode any prior state.
+	r.StateUpgraders = []schema.StateUpgrader{
+		{
+			Version: 0,
+			Type:    r.CoreConfigSchema().ImpliedType(),
+			Upgrade: resourcePipelineStateUpgradeV0,
+		},
+		{
+			Version: 1,
+			Type:    r.CoreConfigSchema().ImpliedType(),
+			Upgrade: resourcePipelineStateUpgradeV1,
+		},
+	}
+
+	return r
 }
 
 type Pipeline struct {
 	Id                              string                 `json:"id,omitempty"`
+	GraphQLID                       string                 `json:"graphql_id,omitempty"`
 	Environment                     map[string]string      `json:"env,omitempty"`
 	Slug                            string                 `json:"slug,omitempty"`
 	WebURL                          string                 `json:"web_url,omitempty"`
@@ -317,59 +289,25 @@ type Pipeline struct {
 	SkipQueuedBranchBuildsFilter    string                 `json:"skip_queued_branch_builds_filter,omitempty"`
 	CancelRunningBranchBuilds       bool                   `json:"cancel_running_branch_builds,omitempty"`
 	CancelRunningBranchBuildsFilter string                 `json:"cancel_running_branch_builds_filter,omitempty"`
-	Provider                        repositoryProvider     `json:"provider,omitempty"`
+	DefaultTimeoutInMinutes         int                    `json:"default_timeout_in_minutes,omitempty"`
+	MaximumTimeoutInMinutes         int                    `json:"maximum_timeout_in_minutes,omitempty"`
+	Provider                        *repositoryProvider    `json:"provider,omitempty"`
 	ProviderSettings                map[string]interface{} `json:"provider_settings,omitempty"`
-	Steps                           []Step                 `json:"steps"`
-}
-
-type repositoryProvider struct {
-	RepositoryProviderId string
-	Settings             map[string]interface{}
-	WebhookURL           string
-}
-
-var providerSettingsExcluded = [...]string{"repository", "account"}
-
-func (p repositoryProvider) MarshalJSON() ([]byte, error) {
-	// We only need to Unmarshall from the API
-	return []byte("null"), nil
-}
-
-func (p *repositoryProvider) UnmarshalJSON(data []byte) error {
-	var provider map[string]interface{}
-
-	if err := json.Unmarshal(data, &provider); err != nil {
-		return err
-	}
-
-	p.RepositoryProviderId = provider["id"].(string)
-	webhook, ok := provider["webhook_url"]
-	if ok {
-		p.WebhookURL = webhook.(string)
-	}
-
-	settings := provider["settings"].(map[string]interface{})
-
-	for _, k := range providerSettingsExcluded {
-		delete(settings, k)
-	}
-
-	p.Settings = settings
-
-	return nil
-}
-
-type Step struct {
-	Type                string            `json:"type"`
-	Name                string            `json:"name,omitempty"`
-	Command             string            `json:"command,omitempty"`
-	Environment         map[string]string `json:"env,omitempty"`
-	TimeoutInMinutes    int               `json:"timeout_in_minutes,omitempty"`
-	AgentQueryRules     []string          `json:"agent_query_rules,omitempty"`
-	BranchConfiguration string            `json:"branch_configuration,omitempty"`
-	ArtifactPaths       string            `json:"artifact_paths,omitempty"`
-	Concurrency         int               `json:"concurrency,omitempty"`
-	Parallelism         int               `json:"parallelism,omitempty"`
+	Notify                          []Notification         `json:"notify,omitempty"`
+	Visibility                      string                 `json:"visibility,omitempty"`
+	TeamUUIDs                       []string               `json:"team_uuids,omitempty"`
+	Tags                            []string               `json:"tags,omitempty"`
+	Emoji                           string                 `json:"emoji,omitempty"`
+	Color                           string                 `json:"color,omitempty"`
+	ClusterID                       string                 `json:"cluster_id,omitempty"`
+	ArchivedAt                      string                 `json:"archived_at,omitempty"`
+	RunningBuildsCount              int                    `json:"running_builds_count,omitempty"`
+	ScheduledBuildsCount            int                    `json:"scheduled_builds_count,omitempty"`
+	Configuration                   string                 `json:"configuration,omitempty"`
+	Steps                           []Step                 `json:"steps,omitempty"`
+
+	// Fields without attributes, see resource_pipeline_extra.go
+	Extra map[string]json.RawMessage `json:"-"`
 }
 
 func CreatePipeline(d *schema.ResourceData, meta interface{}) error {
@@ -385,18 +323,38 @@ func CreatePipeline(d *schema.ResourceData, meta interface{}) error {
 		return err
 	}
 
-	return updatePipelineFromAPI(d, res)
+	if err := updatePipelineFromAPI(d, res, client.defaultTags); err != nil {
+		return err
+	}
+	if err := readPipelineCluster(d, client); err != nil {
+		return err
+	}
+
+	// Teams are added with the default access level, which is then changed
+	// where it differs
+	current, err := readPipelineTeams(client, res.Id, req.TeamUUIDs)
+	if err != nil {
+		return err
+	}
+	if err := updatePipelineTeams(d, client, res.Id, current); err != nil {
+		return err
+	}
+
+	if d.Get("archived").(bool) {
+		if err := setPipelineArchived(client, res.Slug, true, res); err != nil {
+			return err
+		}
+		d.Set("archived", res.ArchivedAt != "")
+	}
+	return nil
 }
 
 func ReadPipeline(d *schema.ResourceData, meta interface{}) error {
 	log.Printf("[TRACE] ReadPipeline")
 
 	client := meta.(*Client)
-	slug := d.Id()
-
-	res := &Pipeline{}
 
-	err := client.Get([]string{"pipelines", slug}, res)
+	res, err := findPipeline(client, d.Id(), pipelineSlug(d))
 	if err != nil {
 		if _, ok := err.(*notFound); ok {
 			d.SetId("")
@@ -405,24 +363,66 @@ func ReadPipeline(d *schema.ResourceData, meta interface{}) error {
 		return err
 	}
 
-	return updatePipelineFromAPI(d, res)
+	if err := updatePipelineFromAPI(d, res, client.defaultTags); err != nil {
+		return err
+	}
+	if err := readPipelineCluster(d, client); err != nil {
+		return err
+	}
+	return readTeamsIntoState(d, client, res.Id)
 }
 
 func UpdatePipeline(d *schema.ResourceData, meta interface{}) error {
 	log.Printf("[TRACE] UpdatePipeline")
 
 	client := meta.(*Client)
-	slug := d.Id()
+	slug := pipelineSlug(d)
 
-	req := preparePipelineRequestPayload(d)
+	req := preparePipelineUpdatePayload(d)
 	res := &Pipeline{}
 
-	err := client.Patch([]string{"pipelines", slug}, req, res)
-	if err != nil {
-		return err
+	// Archived pipelines can't be changed, so they are unarchived before
+	// anything else and archived after
+	archived := d.Get("archived").(bool)
+	if archived && !d.HasChange("archived") && len(req) > 0 {
+		return fmt.Errorf("pipeline %s is archived, set archived = false to change it", slug)
+	}
+	if d.HasChange("archived") && !archived {
+		if err := setPipelineArchived(client, slug, false, nil); err != nil {
+			return err
+		}
+	}
+
+	// Changes to attributes which only affect Terraform, such as
+	// deletion_protection, have nothing to send
+	if len(req) > 0 {
+		if err := resolveSensitiveEnv(client, slug, d.Get("sensitive_env_salt").(string), req); err != nil {
+			return err
+		}
+		if err := client.Patch([]string{"pipelines", slug}, req, res); err != nil {
+			return err
+		}
 	}
 
-	return updatePipelineFromAPI(d, res)
+	if d.HasChange("team") {
+		old, _ := d.GetChange("team")
+		if err := updatePipelineTeams(d, client, d.Id(), expandTeams(old)); err != nil {
+			return err
+		}
+	}
+
+	if d.HasChange("archived") && archived {
+		if err := setPipelineArchived(client, slug, true, res); err != nil {
+			return err
+		}
+	} else if len(req) == 0 {
+		return nil
+	}
+
+	if err := updatePipelineFromAPI(d, res, client.defaultTags); err != nil {
+		return err
+	}
+	return readPipelineCluster(d, client)
 }
 
 func DeletePipeline(d *schema.ResourceData, meta interface{}) error {
@@ -430,16 +430,40 @@ func DeletePipeline(d *schema.ResourceData, meta interface{}) error {
 
 	client := meta.(*Client)
 
-	slug := d.Id()
+	slug := pipelineSlug(d)
+
+	if err := checkDeletionProtection(d); err != nil {
+		return err
+	}
+	cancel := d.Get("cancel_builds_on_destroy").(bool)
+	if err := ensureNoActiveBuilds(client, slug, cancel, d.Timeout(schema.TimeoutDelete)); err != nil {
+		return err
+	}
+
+	if d.Get("deletion_behavior").(string) == "archive" {
+		if d.Get("archived").(bool) {
+			log.Printf("[INFO] buildkite: Pipeline %s is already archived", slug)
+			return nil
+		}
+		return setPipelineArchived(client, slug, true, nil)
+	}
 
 	return client.Delete([]string{"pipelines", slug})
 }
 
-func updatePipelineFromAPI(d *schema.ResourceData, p *Pipeline) error {
-	d.SetId(p.Slug)
+func updatePipelineFromAPI(d *schema.ResourceData, p *Pipeline, defaults []string) error {
+	d.SetId(p.Id)
 	log.Printf("[INFO] buildkite: Pipeline ID: %s", d.Id())
 
-	d.Set("env", p.Environment)
+	d.Set("graphql_id", p.GraphQLID)
+
+	salt, err := sensitiveEnvSalt(d)
+	if err != nil {
+		return err
+	}
+	env, sensitiveEnv := splitSensitiveEnv(p.Environment, d.Get("sensitive_env"), salt)
+	d.Set("env", env)
+	d.Set("sensitive_env", sensitiveEnv)
 	d.Set("name", p.Name)
 	d.Set("description", p.Description)
 	d.Set("repository", p.Repository)
@@ -452,56 +476,77 @@ func updatePipelineFromAPI(d *schema.ResourceData, p *Pipeline) error {
 	d.Set("skip_queued_branch_builds_filter", p.SkipQueuedBranchBuildsFilter)
 	d.Set("cancel_running_branch_builds", p.CancelRunningBranchBuilds)
 	d.Set("cancel_running_branch_builds_filter", p.CancelRunningBranchBuildsFilter)
+	d.Set("default_timeout_in_minutes", p.DefaultTimeoutInMinutes)
+	d.Set("maximum_timeout_in_minutes", p.MaximumTimeoutInMinutes)
+	d.Set("visibility", p.Visibility)
+	d.Set("cluster_id", p.ClusterID)
+	d.Set("archived", p.ArchivedAt != "")
+	d.Set("running_builds_count", p.RunningBuildsCount)
+	d.Set("scheduled_builds_count", p.ScheduledBuildsCount)
+	d.Set("emoji", p.Emoji)
+	d.Set("color", p.Color)
+	d.Set("extra_json", flattenExtraJSON(p.Extra, d.Get("extra_json")))
+
+	tags := mergeTags(p.Tags, nil)
+	prior := expandTags(d.Get("tags"))
+	d.Set("tags", pipelineTags(tags, defaults, prior))
+	d.Set("tags_all", tags)
+
+	if err := d.Set("notify", flattenNotifications(p.Notify)); err != nil {
+		return err
+	}
 
-	stepMap := make([]interface{}, len(p.Steps))
-	for i, element := range p.Steps {
-		stepMap[i] = map[string]interface{}{
-			"type":                 element.Type,
-			"name":                 element.Name,
-			"command":              element.Command,
-			"env":                  element.Environment,
-			"agent_query_rules":    element.AgentQueryRules,
-			"branch_configuration": element.BranchConfiguration,
-			"artifact_paths":       element.ArtifactPaths,
-			"concurrency":          element.Concurrency,
-			"parallelism":          element.Parallelism,
-			"timeout_in_minutes":   element.TimeoutInMinutes,
+	// The API also returns the steps derived from a YAML configuration, these
+	// are only written to state for pipelines managed through step blocks.
+	if usesConfiguration(d, p) {
+		d.Set("configuration", p.Configuration)
+		if err := d.Set("step", []interface{}{}); err != nil {
+			return err
+		}
+	} else {
+		d.Set("configuration", "")
+		if err := d.Set("step", flattenSteps(p.Steps, d.Get("step").([]interface{}), salt, false)); err != nil {
+			return err
 		}
 	}
-	if err := d.Set("step", stepMap); err != nil {
+	extraFields := extraFieldPaths(d.Get)
+	if len(extraFields) > 0 {
+		log.Printf("[WARN] buildkite: Pipeline %s has fields without attributes, kept in extra_json: %s", p.Slug, strings.Join(extraFields, ", "))
+	}
+	d.Set("extra_fields", extraFields)
+
+	rendered, err := renderedConfiguration(d.Get)
+	if err != nil {
 		return err
 	}
+	d.Set("rendered_configuration", rendered)
 
-	emptySettings := make([]interface{}, 0)
-	d.Set("github_settings", emptySettings)
-	d.Set("bitbucket_settings", emptySettings)
+	// Keep what we have rather than clearing the settings when the API
+	// leaves out the provider
+	if p.Provider == nil {
+		log.Printf("[WARN] buildkite: No repository provider returned for pipeline %s", p.Slug)
+		return nil
+	}
 
 	log.Printf("[INFO] buildkite: RepositoryProviderId: %s", p.Provider.RepositoryProviderId)
 
-	switch p.Provider.RepositoryProviderId {
-	case "github":
-		d.Set("webhook_url", p.Provider.WebhookURL)
+	d.Set("webhook_url", p.Provider.WebhookURL)
 
-		log.Printf("[DEBUG] buildkite: Provider.Settings in github: %+v", p.Provider.Settings)
-		if err := d.Set("github_settings", []map[string]interface{}{p.Provider.Settings}); err != nil {
-			return err
+	// Settings are only read into the blocks in use, so a removed block
+	// stays removed
+	attr, settings := p.Provider.settings()
+	log.Printf("[DEBUG] buildkite: Provider.Settings in %s: %+v", p.Provider.RepositoryProviderId, settings)
+	for _, block := range providerSettingsBlocks {
+		if len(d.Get(block.Attr).([]interface{})) == 0 {
+			continue
 		}
-
-	case "bitbucket":
-		d.Set("webhook_url", p.Provider.WebhookURL)
-
-		log.Printf("[DEBUG] buildkite: Provider.Settings in bitbucket: %+v", p.Provider.Settings)
-		if err := d.Set("bitbucket_settings", []map[string]interface{}{p.Provider.Settings}); err != nil {
+		if block.Attr != attr {
+			d.Set(block.Attr, []interface{}{})
+			continue
+		}
+		if err := d.Set(attr, flattenProviderSettings(settings)); err != nil {
 			return err
 		}
-
-	case "gitlab":
-		d.Set("webhook_url", p.Provider.WebhookURL)
-
-	case "beanstalk":
-		d.Set("webhook_url", p.Provider.WebhookURL)
-
-	default: // unknown, noop
 	}
 
 	return nil
@@ -520,64 +565,146 @@ func preparePipelineRequestPayload(d *schema.ResourceData) *Pipeline {
 	req.SkipQueuedBranchBuildsFilter = d.Get("skip_queued_branch_builds_filter").(string)
 	req.CancelRunningBranchBuilds = d.Get("cancel_running_branch_builds").(bool)
 	req.CancelRunningBranchBuildsFilter = d.Get("cancel_running_branch_builds_filter").(string)
+	req.DefaultTimeoutInMinutes = d.Get("default_timeout_in_minutes").(int)
+	req.MaximumTimeoutInMinutes = d.Get("maximum_timeout_in_minutes").(int)
+	req.Visibility = d.Get("visibility").(string)
+	req.TeamUUIDs = teamUUIDs(expandTeams(d.Get("team")))
+	req.Tags = expandTags(d.Get("tags_all"))
+	req.ClusterID = d.Get("cluster_id").(string)
+	req.Emoji = d.Get("emoji").(string)
+	req.Color = d.Get("color").(string)
+	req.Extra = expandExtraJSON(d.Get("extra_json").(string))
 	req.Environment = map[string]string{}
 	for k, vI := range d.Get("env").(map[string]interface{}) {
 		req.Environment[k] = vI.(string)
 	}
+	mergeSensitiveEnv(req.Environment, d.Get("sensitive_env"))
+
+	req.Notify = expandNotifications(d.Get("notify").([]interface{}))
+	req.Configuration = d.Get("configuration").(string)
+	if req.Configuration == "" {
+		req.Steps = expandSteps(d.Get("step").([]interface{}))
+		addStepSensitiveEnv(req.Steps, d.Get("step").([]interface{}))
+	}
+
+	if d.Get("manage_provider_settings").(string) == "authoritative" {
+		req.ProviderSettings = authoritativeProviderSettings(d)
+		return req
+	}
 
-	stepsI := d.Get("step").([]interface{})
-	req.Steps = make([]Step, len(stepsI))
-
-	for i, stepI := range stepsI {
-		stepM := stepI.(map[string]interface{})
-		req.Steps[i] = Step{
-			Type:                stepM["type"].(string),
-			Name:                stepM["name"].(string),
-			Command:             stepM["command"].(string),
-			Environment:         map[string]string{},
-			AgentQueryRules:     make([]string, len(stepM["agent_query_rules"].([]interface{}))),
-			BranchConfiguration: stepM["branch_configuration"].(string),
-			ArtifactPaths:       stepM["artifact_paths"].(string),
-			Concurrency:         stepM["concurrency"].(int),
-			Parallelism:         stepM["parallelism"].(int),
-			TimeoutInMinutes:    stepM["timeout_in_minutes"].(int),
+	// Only one settings block can be set, the others may have changed by
+	// being removed.
+	for _, block := range providerSettingsBlocks {
+		if !d.HasChange(block.Attr) {
+			continue
 		}
+		log.Printf("[INFO] buildkite: RepositoryProviderSettings have changed")
 
-		for k, vI := range stepM["env"].(map[string]interface{}) {
-			req.Steps[i].Environment[k] = vI.(string)
+		// A removed block leaves the settings as they are
+		if blockSettings := d.Get(block.Attr).([]interface{}); len(blockSettings) > 0 {
+			if req.ProviderSettings == nil {
+				req.ProviderSettings = map[string]interface{}{}
+			}
+			for k, vI := range blockSettings[0].(map[string]interface{}) {
+				if d.HasChange(fmt.Sprintf("%s.0.%s", block.Attr, k)) {
+					req.ProviderSettings[k] = vI
+				}
+			}
 		}
+	}
 
-		for j, vI := range stepM["agent_query_rules"].([]interface{}) {
-			req.Steps[i].AgentQueryRules[j] = vI.(string)
+	return req
+}
+
+// preparePipelineUpdatePayload builds a PATCH of every changed attribute. The
+// Pipeline struct omits zero values, which suits creates but would make it
+// impossible to turn a setting off or clear it, so changes are sent as they
+// are, with timeouts cleared by null.
+func preparePipelineUpdatePayload(d *schema.ResourceData) map[string]interface{} {
+	req := preparePipelineRequestPayload(d)
+	patch := map[string]interface{}{}
+
+	for _, field := range []struct {
+		attr  string
+		value interface{}
+	}{
+		{"name", req.Name},
+		{"default_branch", req.DefaultBranch},
+		{"description", req.Description},
+		{"repository", req.Repository},
+		{"branch_configuration", req.BranchConfiguration},
+		{"skip_queued_branch_builds", req.SkipQueuedBranchBuilds},
+		{"skip_queued_branch_builds_filter", req.SkipQueuedBranchBuildsFilter},
+		{"cancel_running_branch_builds", req.CancelRunningBranchBuilds},
+		{"cancel_running_branch_builds_filter", req.CancelRunningBranchBuildsFilter},
+		{"default_timeout_in_minutes", nullIfZero(req.DefaultTimeoutInMinutes)},
+		{"maximum_timeout_in_minutes", nullIfZero(req.MaximumTimeoutInMinutes)},
+		{"visibility", req.Visibility},
+		{"cluster_id", nullIfEmpty(req.ClusterID)},
+		{"emoji", req.Emoji},
+		{"color", req.Color},
+		{"notify", append([]Notification{}, req.Notify...)},
+	} {
+		if d.HasChange(field.attr) {
+			patch[field.attr] = field.value
 		}
 	}
 
-	if d.HasChange("github_settings") || d.HasChange("bitbucket_settings") {
-		log.Printf("[INFO] buildkite: RepositoryProviderSettings have changed")
+	if d.HasChange("env") || d.HasChange("sensitive_env") {
+		patch["env"] = req.Environment
+	}
 
-		githubSettings := d.Get("github_settings").([]interface{})
-		bitbucketSettings := d.Get("bitbucket_settings").([]interface{})
-		settings := map[string]interface{}{}
+	// A renamed pipeline gets a new slug, unless it is pinned
+	if req.Slug != "" && (d.HasChange("slug") || d.HasChange("name")) {
+		patch["slug"] = req.Slug
+	}
 
-		if len(githubSettings) > 0 {
-			s := githubSettings[0].(map[string]interface{})
+	if d.HasChange("tags_all") {
+		patch["tags"] = append([]string{}, req.Tags...)
+	}
 
-			for k, vI := range s {
-				if d.HasChange(fmt.Sprintf("github_settings.0.%s", k)) {
-					settings[k] = vI
-				}
-			}
-		} else if len(bitbucketSettings) > 0 {
-			s := bitbucketSettings[0].(map[string]interface{})
+	// Fields removed from extra_json are cleared
+	if d.HasChange("extra_json") {
+		old, _ := d.GetChange("extra_json")
+		for name := range expandExtraJSON(old.(string)) {
+			patch[name] = nil
+		}
+		for name, raw := range req.Extra {
+			patch[name] = raw
+		}
+	}
 
-			for k, vI := range s {
-				if d.HasChange(fmt.Sprintf("bitbucket_settings.0.%s", k)) {
-					settings[k] = vI
-				}
+	// A pipeline is defined by either its configuration or its steps, moving
+	// to steps clears the configuration.
+	if d.HasChange("configuration") || d.HasChange("step") {
+		if req.Configuration != "" {
+			patch["configuration"] = req.Configuration
+		} else {
+			if d.HasChange("configuration") {
+				patch["configuration"] = nil
 			}
+			patch["steps"] = append([]Step{}, req.Steps...)
 		}
-		req.ProviderSettings = settings
 	}
 
-	return req
+	// Authoritative settings are sent in full, but only along with a change
+	if req.ProviderSettings != nil && (len(patch) > 0 || providerSettingsChanged(d)) {
+		patch["provider_settings"] = req.ProviderSettings
+	}
+
+	return patch
+}
+
+func nullIfZero(i int) interface{} {
+	if i == 0 {
+		return nil
+	}
+	return i
+}
+
+func nullIfEmpty(s string) interface{} {
+	if s == "" {
+		return nil
+	}
+	return s
 }
@@ -0,0 +1,212 @@
+package buildkite
+
+import (
+	"fmt"
+	"log"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Agent tags are word characters, dots, dashes and slashes. Values may
+// additionally contain * wildcards, but never whitespace around them.
+var (
+	agentTagKeyRegexp   = regexp.MustCompile(`^[a-zA-Z0-9_.\-/]+$`)
+	agentTagValueRegexp = regexp.MustCompile(`^\S(.*\S)?$`)
+)
+
+func validateAgentTag(key, value string) error {
+	if !agentTagKeyRegexp.MatchString(key) {
+		return fmt.Errorf("invalid agent tag %q", key)
+	}
+	if !agentTagValueRegexp.MatchString(value) {
+		return fmt.Errorf("invalid value %q for agent tag %q", value, key)
+	}
+	return nil
+}
+
+func validateAgentQueryRule(v interface{}, k string) ([]string, []error) {
+	rule := v.(string)
+
+	parts := strings.SplitN(rule, "=", 2)
+	if len(parts) != 2 {
+		return nil, []error{fmt.Errorf("%s: %q must be in the form key=value", k, rule)}
+	}
+	if err := validateAgentTag(parts[0], parts[1]); err != nil {
+		return nil, []error{fmt.Errorf("%s: %s", k, err)}
+	}
+	return nil, nil
+}
+
+func validateAgents(v interface{}, k string) ([]string, []error) {
+	var errs []error
+	for key, vI := range v.(map[string]interface{}) {
+		value, _ := vI.(string)
+		if err := validateAgentTag(key, value); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %s", k, err))
+		}
+	}
+	return nil, errs
+}
+
+// parseAgentQueryRules turns a list of key=value rules into an agents map.
+// Malformed rules are skipped, the schema rejects them at plan time.
+func parseAgentQueryRules(rules []string) map[string]string {
+	agents := make(map[string]string, len(rules))
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		if len(parts) != 2 {
+			log.Printf("[WARN] buildkite: Ignoring malformed agent query rule %q", rule)
+			continue
+		}
+		agents[parts[0]] = parts[1]
+	}
+	return agents
+}
+
+func formatAgentQueryRules(agents map[string]string) []string {
+	rules := make([]string, 0, len(agents))
+	for k, v := range agents {
+		rules = append(rules, fmt.Sprintf("%s=%s", k, v))
+	}
+	sort.Strings(rules)
+	return rules
+}
+
+// stepAgents returns the agent targeting of a step as returned by the API,
+// which may use either or both of the legacy rules and the agents map.
+func stepAgents(step Step) map[string]string {
+	agents := parseAgentQueryRules(step.AgentQueryRules)
+	for k, v := range step.Agents {
+		agents[k] = v
+	}
+	return agents
+}
+
+// flattenAgentQueryRules keeps the agent_query_rules of the prior state when
+// they still describe the same targeting as the API, so configurations
+// which haven't moved to agents yet don't show a diff.
+func flattenAgentQueryRules(agents map[string]string, priorI interface{}) []string {
+	prior := []string{}
+	if l, ok := priorI.([]interface{}); ok {
+		for _, vI := range l {
+			if v, ok := vI.(string); ok {
+				prior = append(prior, v)
+			}
+		}
+	}
+	if len(prior) == 0 {
+		return prior
+	}
+
+	if reflect.DeepEqual(parseAgentQueryRules(prior), agents) {
+		return prior
+	}
+	return formatAgentQueryRules(agents)
+}
+
+// stepTargeting returns the agents a step targets, from its agents map or
+// otherwise its agent_query_rules.
+func stepTargeting(agentsI, rulesI interface{}) map[string]string {
+	agents := map[string]string{}
+	if m, ok := agentsI.(map[string]interface{}); ok {
+		for k, vI := range m {
+			agents[k], _ = vI.(string)
+		}
+	}
+	if len(agents) > 0 {
+		return agents
+	}
+
+	rules := []string{}
+	if l, ok := rulesI.([]interface{}); ok {
+		for _, vI := range l {
+			if v, ok := vI.(string); ok {
+				rules = append(rules, v)
+			}
+		}
+	}
+	return parseAgentQueryRules(rules)
+}
+
+// suppressEquivalentAgents hides moving a step between agent_query_rules and
+// an agents map which target the same agents. The state holds whichever of
+// the two is in use, so an empty new value of the other one means it was
+// removed, which still shows a diff and clears the targeting.
+func suppressEquivalentAgents(k, old, new string, d *schema.ResourceData) bool {
+	i := strings.Index(k, ".agent")
+	if i < 0 {
+		return false
+	}
+	prefix := k[:i+1]
+
+	oldAgents, newAgents := d.GetChange(prefix + "agents")
+	oldRules, newRules := d.GetChange(prefix + "agent_query_rules")
+	switch {
+	case isSet(oldRules):
+		return isSet(newAgents) && reflect.DeepEqual(stepTargeting(newAgents, nil), stepTargeting(nil, oldRules))
+	case isSet(oldAgents):
+		return isSet(newRules) && reflect.DeepEqual(stepTargeting(nil, newRules), stepTargeting(oldAgents, nil))
+	}
+	return false
+}
+
+// customizeDiffAgents rejects steps which set both agents and
+// agent_query_rules, as only one of them can be sent. Both are in the state
+// when the rules are in use, so they are only rejected when they differ.
+func customizeDiffAgents(d *schema.ResourceDiff, meta interface{}) error {
+	return walkSteps(d.Get("step").([]interface{}), "step", func(stepM map[string]interface{}, path string) error {
+		if !d.NewValueKnown(path+".agents") || !d.NewValueKnown(path+".agent_query_rules") {
+			return nil
+		}
+		if !isSet(stepM["agents"]) || !isSet(stepM["agent_query_rules"]) {
+			return nil
+		}
+		if !reflect.DeepEqual(stepTargeting(stepM["agents"], nil), stepTargeting(nil, stepM["agent_query_rules"])) {
+			return fmt.Errorf("%s: agents and agent_query_rules can't both be set, use agents", path)
+		}
+		return nil
+	})
+}
+
+// resourcePipelineStateUpgradeV0 populates the agents map of every step from
+// its agent_query_rules.
+func resourcePipelineStateUpgradeV0(rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	log.Printf("[INFO] buildkite: Upgrading pipeline state from version 0")
+
+	stepsI, _ := rawState["step"].([]interface{})
+	upgradeStepsAgentsV0(stepsI)
+
+	return rawState, nil
+}
+
+func upgradeStepsAgentsV0(stepsI []interface{}) {
+	for _, stepI := range stepsI {
+		stepM, ok := stepI.(map[string]interface{})
+		if !ok {
+			continue
+		}
+
+		rules := []string{}
+		if rulesI, ok := stepM["agent_query_rules"].([]interface{}); ok {
+			for _, vI := range rulesI {
+				if v, ok := vI.(string); ok {
+					rules = append(rules, v)
+				}
+			}
+		}
+
+		agents := map[string]interface{}{}
+		for k, v := range parseAgentQueryRules(rules) {
+			agents[k] = v
+		}
+		stepM["agents"] = agents
+
+		if nestedI, ok := stepM["step"].([]interface{}); ok {
+			upgradeStepsAgentsV0(nestedI)
+		}
+	}
+}
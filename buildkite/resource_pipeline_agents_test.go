@@ -0,0 +1,179 @@
+package buildkite
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestValidateAgentQueryRule(t *testing.T) {
+	valid := []string{
+		"queue=default",
+		"queue=deploy-*",
+		"os/arch=linux/amd64",
+		"docker=true",
+	}
+	for _, v := range valid {
+		if _, errs := validateAgentQueryRule(v, "agent_query_rules.0"); len(errs) > 0 {
+			t.Errorf("%q: unexpected errors: %v", v, errs)
+		}
+	}
+
+	invalid := []string{
+		"queue",
+		"queue=",
+		"=default",
+		"queue = default",
+		"que ue=default",
+	}
+	for _, v := range invalid {
+		if _, errs := validateAgentQueryRule(v, "agent_query_rules.0"); len(errs) == 0 {
+			t.Errorf("%q: expected an error", v)
+		}
+	}
+}
+
+func TestFlattenAgentQueryRules(t *testing.T) {
+	agents := map[string]string{"queue": "deploy", "os": "linux"}
+
+	// Prior rules in a different order are kept as they are
+	prior := []interface{}{"queue=deploy", "os=linux"}
+	if got := flattenAgentQueryRules(agents, prior); !reflect.DeepEqual(got, []string{"queue=deploy", "os=linux"}) {
+		t.Errorf("expected prior rules to be kept, got %v", got)
+	}
+
+	// Drift is reported in canonical form
+	prior = []interface{}{"queue=default"}
+	if got := flattenAgentQueryRules(agents, prior); !reflect.DeepEqual(got, []string{"os=linux", "queue=deploy"}) {
+		t.Errorf("expected rules from the API, got %v", got)
+	}
+
+	// Without prior rules the agents map is used on its own
+	if got := flattenAgentQueryRules(agents, nil); len(got) != 0 {
+		t.Errorf("expected no rules, got %v", got)
+	}
+}
+
+func TestResourcePipelineStateUpgradeV0(t *testing.T) {
+	rawState := map[string]interface{}{
+		"name": "test",
+		"step": []interface{}{
+			map[string]interface{}{
+				"type":              "script",
+				"agent_query_rules": []interface{}{"queue=deploy", "os=linux"},
+			},
+			map[string]interface{}{
+				"type": "group",
+				"step": []interface{}{
+					map[string]interface{}{
+						"type":              "script",
+						"agent_query_rules": []interface{}{"queue=test"},
+					},
+				},
+			},
+		},
+	}
+
+	actual, err := resourcePipelineStateUpgradeV0(rawState, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := actual["step"].([]interface{})
+	expected := map[string]interface{}{"queue": "deploy", "os": "linux"}
+	if got := steps[0].(map[string]interface{})["agents"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %#v, want %#v", got, expected)
+	}
+
+	nested := steps[1].(map[string]interface{})["step"].([]interface{})
+	expected = map[string]interface{}{"queue": "test"}
+	if got := nested[0].(map[string]interface{})["agents"]; !reflect.DeepEqual(got, expected) {
+		t.Errorf("got %#v, want %#v", got, expected)
+	}
+}
+
+func TestSuppressEquivalentAgents(t *testing.T) {
+	step := func(attrs map[string]interface{}) []interface{} {
+		s := map[string]interface{}{"type": "script", "command": "make"}
+		for k, v := range attrs {
+			s[k] = v
+		}
+		return []interface{}{s}
+	}
+	agents := map[string]interface{}{"queue": "deploy"}
+	rules := []interface{}{"queue=deploy"}
+
+	for _, tc := range []struct {
+		name          string
+		state, config map[string]interface{}
+		expected      []string
+	}{
+		{
+			"moved to agents",
+			map[string]interface{}{"agent_query_rules": rules},
+			map[string]interface{}{"agents": agents},
+			nil,
+		},
+		{
+			"moved to rules",
+			map[string]interface{}{"agents": agents},
+			map[string]interface{}{"agent_query_rules": rules},
+			nil,
+		},
+		{
+			"changed",
+			map[string]interface{}{"agents": agents},
+			map[string]interface{}{"agents": map[string]interface{}{"queue": "test"}},
+			[]string{"queue=test"},
+		},
+		{
+			"removed",
+			map[string]interface{}{"agents": agents},
+			map[string]interface{}{},
+			[]string{},
+		},
+		{
+			"rules removed",
+			map[string]interface{}{"agent_query_rules": rules},
+			map[string]interface{}{},
+			[]string{},
+		},
+	} {
+		base := func(attrs map[string]interface{}) map[string]interface{} {
+			return map[string]interface{}{
+				"name":       "test",
+				"repository": "git@github.com:buildkite/example.git",
+				"step":       step(attrs),
+			}
+		}
+		d, diff := testPipelineUpdate(t, testPipelineState(t, base(tc.state)), base(tc.config), nil)
+
+		patch := preparePipelineUpdatePayload(d)
+		steps, ok := patch["steps"].([]Step)
+		switch {
+		case tc.expected == nil && ok:
+			t.Errorf("%s: expected no change, got %v", tc.name, diff)
+		case tc.expected != nil && !ok:
+			t.Errorf("%s: expected the steps to be sent", tc.name)
+		case ok && !reflect.DeepEqual(append([]string{}, steps[0].AgentQueryRules...), tc.expected):
+			t.Errorf("%s: got rules %v, want %v", tc.name, steps[0].AgentQueryRules, tc.expected)
+		}
+	}
+}
+
+func TestCustomizeDiffAgents(t *testing.T) {
+	_, err := testPipelineDiff(t, nil, map[string]interface{}{
+		"name":       "test",
+		"repository": "git@github.com:buildkite/example.git",
+		"step": []interface{}{map[string]interface{}{
+			"type":              "script",
+			"command":           "make",
+			"agents":            map[string]interface{}{"queue": "deploy"},
+			"agent_query_rules": []interface{}{"queue=test"},
+		}},
+	}, nil)
+	expected := "step.0: agents and agent_query_rules can't both be set, use agents"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("got error %v, want %q", err, expected)
+	}
+}
@@ -0,0 +1,22 @@
+package buildkite
+
+import (
+	"log"
+)
+
+// Archived pipelines keep their build history but can't be built or
+// changed. The archive endpoints return the pipeline, which is decoded into
+// res when given.
+func setPipelineArchived(client *Client, slug string, archived bool, res *Pipeline) error {
+	action := "unarchive"
+	if archived {
+		action = "archive"
+	}
+	log.Printf("[INFO] buildkite: Pipeline %s: %s", slug, action)
+
+	var resBody interface{}
+	if res != nil {
+		resBody = res
+	}
+	return client.Post([]string{"pipelines", slug, action}, nil, resBody)
+}
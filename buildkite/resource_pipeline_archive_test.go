@@ -0,0 +1,147 @@
+package buildkite
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// testArchiveAPI serves a pipeline which is archived once the archive
+// endpoint has been called.
+func testArchiveAPI(t *testing.T) *testAPI {
+	api := newTestAPI(t)
+	archivedAt := ""
+	pipeline := func(r *http.Request) string {
+		return fmt.Sprintf(`{"slug": "test", "archived_at": %q}`, archivedAt)
+	}
+
+	api.Handle("GET pipelines/test", pipeline)
+	api.Handle("PATCH pipelines/test", pipeline)
+	api.Respond("DELETE pipelines/test", "{}")
+	api.Handle("POST pipelines/test/archive", func(r *http.Request) string {
+		archivedAt = "2020-01-01T00:00:00Z"
+		return pipeline(r)
+	})
+	api.Handle("POST pipelines/test/unarchive", func(r *http.Request) string {
+		archivedAt = ""
+		return pipeline(r)
+	})
+	return api
+}
+
+func TestDeletePipeline_archive(t *testing.T) {
+	for behavior, expected := range map[string][]string{
+		"delete":  {"GET pipelines/test", "DELETE pipelines/test"},
+		"archive": {"GET pipelines/test", "POST pipelines/test/archive"},
+	} {
+		api := testArchiveAPI(t)
+		d := schema.TestResourceDataRaw(t, resourcePipeline().Schema, map[string]interface{}{
+			"name":              "test",
+			"deletion_behavior": behavior,
+		})
+		d.SetId("test")
+		if err := DeletePipeline(d, api.client); err != nil {
+			t.Fatal(err)
+		}
+		if requests := api.Requests(); !reflect.DeepEqual(requests, expected) {
+			t.Errorf("%s: got requests %v, want %v", behavior, requests, expected)
+		}
+		api.Close()
+	}
+}
+
+func TestUpdatePipeline_archived(t *testing.T) {
+	base := map[string]interface{}{
+		"name":       "test",
+		"repository": "git@github.com:buildkite/example.git",
+		"step": []interface{}{
+			map[string]interface{}{"type": "script", "command": "make"},
+		},
+	}
+	with := func(m map[string]interface{}) map[string]interface{} {
+		merged := map[string]interface{}{}
+		for k, v := range base {
+			merged[k] = v
+		}
+		for k, v := range m {
+			merged[k] = v
+		}
+		return merged
+	}
+
+	for _, tc := range []struct {
+		name     string
+		state    map[string]interface{}
+		config   map[string]interface{}
+		requests []string
+		archived bool
+		err      string
+	}{
+		{
+			name:     "archive",
+			state:    base,
+			config:   with(map[string]interface{}{"archived": true}),
+			requests: []string{"POST pipelines/test/archive"},
+			archived: true,
+		},
+		{
+			name:     "unarchive and change",
+			state:    with(map[string]interface{}{"archived": true}),
+			config:   with(map[string]interface{}{"description": "changed"}),
+			requests: []string{"POST pipelines/test/unarchive", "PATCH pipelines/test"},
+		},
+		{
+			name:   "change while archived",
+			state:  with(map[string]interface{}{"archived": true}),
+			config: with(map[string]interface{}{"archived": true, "description": "changed"}),
+			err:    "pipeline test is archived, set archived = false to change it",
+		},
+		{
+			name:     "protect while archived",
+			state:    with(map[string]interface{}{"archived": true}),
+			config:   with(map[string]interface{}{"archived": true, "deletion_protection": true}),
+			requests: nil,
+			archived: true,
+		},
+		{
+			name: "protect while archived with authoritative settings",
+			state: with(map[string]interface{}{
+				"archived":                 true,
+				"manage_provider_settings": "authoritative",
+				"github_settings":          []interface{}{map[string]interface{}{"build_tags": true}},
+			}),
+			config: with(map[string]interface{}{
+				"archived":                 true,
+				"manage_provider_settings": "authoritative",
+				"github_settings":          []interface{}{map[string]interface{}{"build_tags": true}},
+				"deletion_protection":      true,
+			}),
+			requests: nil,
+			archived: true,
+		},
+	} {
+		api := testArchiveAPI(t)
+		d, _ := testPipelineUpdate(t, testPipelineState(t, tc.state), tc.config, nil)
+		err := UpdatePipeline(d, api.client)
+		api.Close()
+
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%s: expected error %q, got %v", tc.name, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%s: %s", tc.name, err)
+		}
+		if requests := api.Requests(); !reflect.DeepEqual(requests, tc.requests) {
+			t.Errorf("%s: got requests %v, want %v", tc.name, requests, tc.requests)
+		}
+		if archived := d.Get("archived").(bool); archived != tc.archived {
+			t.Errorf("%s: got archived %v, want %v", tc.name, archived, tc.archived)
+		}
+	}
+}
@@ -0,0 +1,97 @@
+package buildkite
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Destroying a pipeline with builds in progress would lose them, so it fails
+// unless cancel_builds_on_destroy is set, in which case they are cancelled
+// and waited for.
+
+var buildPollInterval = 5 * time.Second
+
+type build struct {
+	Number int    `json:"number"`
+	State  string `json:"state"`
+}
+
+func activeBuildsCount(p *Pipeline) int {
+	return p.RunningBuildsCount + p.ScheduledBuildsCount
+}
+
+// listActiveBuilds returns the running and scheduled builds of a pipeline.
+func listActiveBuilds(client *Client, slug string) ([]build, error) {
+	var builds []build
+	for page := 1; ; page++ {
+		query := url.Values{
+			"state[]":  []string{"running", "scheduled"},
+			"per_page": []string{"100"},
+			"page":     []string{strconv.Itoa(page)},
+		}
+		var res []build
+		if err := client.GetQuery([]string{"pipelines", slug, "builds"}, query, &res); err != nil {
+			return nil, err
+		}
+		builds = append(builds, res...)
+		if len(res) < 100 {
+			return builds, nil
+		}
+	}
+}
+
+// ensureNoActiveBuilds fails when the pipeline has builds in progress, or
+// cancels them when cancel is set.
+func ensureNoActiveBuilds(client *Client, slug string, cancel bool, timeout time.Duration) error {
+	p := &Pipeline{}
+	if err := client.Get([]string{"pipelines", slug}, p); err != nil {
+		return err
+	}
+	if activeBuildsCount(p) == 0 {
+		return nil
+	}
+	if !cancel {
+		return fmt.Errorf("pipeline %s has %d running and %d scheduled builds, wait for them to finish or set cancel_builds_on_destroy = true",
+			slug, p.RunningBuildsCount, p.ScheduledBuildsCount)
+	}
+
+	builds, err := listActiveBuilds(client, slug)
+	if err != nil {
+		return err
+	}
+	for _, b := range builds {
+		log.Printf("[INFO] buildkite: Cancelling build %d of pipeline %s", b.Number, slug)
+		err := client.Put([]string{"pipelines", slug, "builds", strconv.Itoa(b.Number), "cancel"}, nil, nil)
+		if err != nil {
+			return fmt.Errorf("cancelling build %d of pipeline %s: %s", b.Number, slug, err)
+		}
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		if err := client.Get([]string{"pipelines", slug}, p); err != nil {
+			return err
+		}
+		if activeBuildsCount(p) == 0 {
+			return nil
+		}
+		if time.Now().After(deadline) {
+			return fmt.Errorf("timed out waiting for the builds of pipeline %s to be cancelled, %d are still running",
+				slug, activeBuildsCount(p))
+		}
+		log.Printf("[DEBUG] buildkite: Waiting for %d builds of pipeline %s to finish cancelling", activeBuildsCount(p), slug)
+		time.Sleep(buildPollInterval)
+	}
+}
+
+func checkDeletionProtection(d *schema.ResourceData) error {
+	if d.Get("deletion_protection").(bool) {
+		return fmt.Errorf("pipeline %s has deletion_protection set, set it to false and apply before destroying it", d.Id())
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package buildkite
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// testBuildsAPI serves a pipeline with running builds, which finish once they
+// have been cancelled.
+func testBuildsAPI(t *testing.T) *testAPI {
+	api := newTestAPI(t)
+	running := map[int]bool{1: true, 2: true}
+
+	api.RespondPages("GET pipelines/test/builds", `[{"number": 1, "state": "running"}, {"number": 2, "state": "scheduled"}]`)
+	for number := range running {
+		number := number
+		api.Handle(fmt.Sprintf("PUT pipelines/test/builds/%d/cancel", number), func(r *http.Request) string {
+			delete(running, number)
+			return "{}"
+		})
+	}
+	api.Handle("GET pipelines/test", func(r *http.Request) string {
+		return fmt.Sprintf(`{"slug": "test", "running_builds_count": %d}`, len(running))
+	})
+	api.Respond("DELETE pipelines/test", "{}")
+	return api
+}
+
+func TestDeletePipeline_activeBuilds(t *testing.T) {
+	buildPollInterval = time.Millisecond
+
+	for _, tc := range []struct {
+		config   map[string]interface{}
+		requests []string
+		err      string
+	}{
+		{
+			config: map[string]interface{}{"deletion_protection": true},
+			err:    "pipeline test has deletion_protection set, set it to false and apply before destroying it",
+		},
+		{
+			config: map[string]interface{}{},
+			err:    "pipeline test has 2 running and 0 scheduled builds, wait for them to finish or set cancel_builds_on_destroy = true",
+		},
+		{
+			config: map[string]interface{}{"cancel_builds_on_destroy": true},
+			requests: []string{
+				"GET pipelines/test/builds",
+				"PUT pipelines/test/builds/1/cancel",
+				"PUT pipelines/test/builds/2/cancel",
+				"DELETE pipelines/test",
+			},
+		},
+	} {
+		api := testBuildsAPI(t)
+		d := schema.TestResourceDataRaw(t, resourcePipeline().Schema, tc.config)
+		d.SetId("test")
+		err := DeletePipeline(d, api.client)
+		api.Close()
+
+		if tc.err != "" {
+			if err == nil || err.Error() != tc.err {
+				t.Errorf("%v: expected error %q, got %v", tc.config, tc.err, err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Fatalf("%v: %s", tc.config, err)
+		}
+		// The pipeline is read until its builds finish
+		if requests := api.Requests("GET pipelines/test"); !reflect.DeepEqual(requests, tc.requests) {
+			t.Errorf("%v: got requests %v, want %v", tc.config, requests, tc.requests)
+		}
+	}
+}
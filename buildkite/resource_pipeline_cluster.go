@@ -0,0 +1,164 @@
+package buildkite
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+type cluster struct {
+	Id   string `json:"id"`
+	Name string `json:"name"`
+}
+
+type clusterQueue struct {
+	Id  string `json:"id"`
+	Key string `json:"key"`
+}
+
+func readCluster(client *Client, id string) (*cluster, error) {
+	res := &cluster{}
+	if err := client.Get([]string{"clusters", id}, res); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func readClusterQueues(client *Client, id string) (map[string]bool, error) {
+	queues := map[string]bool{}
+	for page := 1; ; page++ {
+		query := url.Values{
+			"per_page": []string{"100"},
+			"page":     []string{strconv.Itoa(page)},
+		}
+		var res []clusterQueue
+		if err := client.GetQuery([]string{"clusters", id, "queues"}, query, &res); err != nil {
+			return nil, err
+		}
+		for _, q := range res {
+			queues[q.Key] = true
+		}
+		if len(res) < 100 {
+			return queues, nil
+		}
+	}
+}
+
+// readPipelineCluster sets the name of the cluster of the pipeline.
+func readPipelineCluster(d *schema.ResourceData, client *Client) error {
+	id := d.Get("cluster_id").(string)
+	if id == "" {
+		d.Set("cluster_name", "")
+		return nil
+	}
+	c, err := readCluster(client, id)
+	if err != nil {
+		if _, ok := err.(*notFound); ok {
+			log.Printf("[WARN] buildkite: Cluster %s of pipeline %s doesn't exist", id, d.Id())
+			d.Set("cluster_name", "")
+			return nil
+		}
+		return err
+	}
+	d.Set("cluster_name", c.Name)
+	return nil
+}
+
+// stepQueues returns the queue each step targets, by the path of the step.
+// Queues which are only known once a build runs are left out.
+func stepQueues(steps []Step, prefix string) map[string]string {
+	queues := map[string]string{}
+	var walk func(steps []Step, prefix string)
+	walk = func(steps []Step, prefix string) {
+		for i, step := range steps {
+			path := fmt.Sprintf("%s.%d", prefix, i)
+			if queue, ok := stepAgents(step)["queue"]; ok && !strings.ContainsAny(queue, "*$") {
+				queues[path] = queue
+			}
+			walk(step.Steps, path+".step")
+		}
+	}
+	walk(steps, prefix)
+	return queues
+}
+
+// customizeDiffCluster shows the name of the cluster a pipeline moves to, and
+// checks the queues its steps target exist in the cluster. Both need the API,
+// so are only done for changes.
+func customizeDiffCluster(d *schema.ResourceDiff, meta interface{}) error {
+	client, ok := meta.(*Client)
+	if !ok {
+		return nil
+	}
+	if !d.NewValueKnown("cluster_id") {
+		return d.SetNewComputed("cluster_name")
+	}
+
+	id := d.Get("cluster_id").(string)
+	if d.HasChange("cluster_id") {
+		name := ""
+		if id != "" {
+			c, err := readCluster(client, id)
+			if _, ok := err.(*notFound); ok {
+				return fmt.Errorf("cluster_id: cluster %q doesn't exist", id)
+			}
+			if err != nil {
+				return err
+			}
+			name = c.Name
+		}
+		if err := d.SetNew("cluster_name", name); err != nil {
+			return err
+		}
+	}
+
+	if id == "" || !(d.HasChange("cluster_id") || d.HasChange("step") || d.HasChange("configuration")) {
+		return nil
+	}
+	if !d.NewValueKnown("step") || !d.NewValueKnown("configuration") {
+		return nil
+	}
+
+	var queues map[string]string
+	if configuration := d.Get("configuration").(string); configuration != "" {
+		doc, err := parsePipelineYAML(configuration)
+		if err != nil {
+			// Reported by the validation of configuration
+			return nil
+		}
+		queues = stepQueues(doc.Steps, "configuration step")
+	} else {
+		queues = stepQueues(expandSteps(d.Get("step").([]interface{})), "step")
+	}
+	if len(queues) == 0 {
+		return nil
+	}
+
+	existing, err := readClusterQueues(client, id)
+	if err != nil {
+		return err
+	}
+
+	var missing []string
+	for path, queue := range queues {
+		if !existing[queue] {
+			missing = append(missing, fmt.Sprintf("%s: queue %q doesn't exist in cluster %s", path, queue, id))
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+	sort.Strings(missing)
+
+	keys := make([]string, 0, len(existing))
+	for key := range existing {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return fmt.Errorf("%s\n(the cluster has the queues: %s)", strings.Join(missing, "\n"), strings.Join(keys, ", "))
+}
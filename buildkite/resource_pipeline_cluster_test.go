@@ -0,0 +1,119 @@
+package buildkite
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func testClusterAPI(t *testing.T) *testAPI {
+	api := newTestAPI(t)
+	api.Respond("GET clusters/linux", `{"id": "linux", "name": "Linux"}`)
+	api.RespondPages("GET clusters/linux/queues", `[{"id": "1", "key": "default"}, {"id": "2", "key": "arm64"}]`)
+	return api
+}
+
+func testClusterDiff(t *testing.T, client *Client, c map[string]interface{}) (*terraform.InstanceDiff, error) {
+	r := resourcePipeline()
+	old := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"name":       "test",
+		"repository": "git@github.com:buildkite/example.git",
+	})
+	old.Set("cluster_name", "")
+	old.SetId("test")
+	return testPipelineDiff(t, old.State(), c, client)
+}
+
+func TestCustomizeDiffCluster(t *testing.T) {
+	api := testClusterAPI(t)
+	defer api.Close()
+	client := api.client
+
+	step := func(queue string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":    "script",
+			"command": "make",
+			"agents":  map[string]interface{}{"queue": queue},
+		}
+	}
+
+	diff, err := testClusterDiff(t, client, map[string]interface{}{
+		"name":       "test",
+		"repository": "git@github.com:buildkite/example.git",
+		"cluster_id": "linux",
+		"step":       []interface{}{step("arm64"), step("deploy-*")},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if attr := diff.Attributes["cluster_name"]; attr == nil || attr.New != "Linux" {
+		t.Errorf("expected the plan to show the cluster name, got %#v", attr)
+	}
+
+	_, err = testClusterDiff(t, client, map[string]interface{}{
+		"name":       "test",
+		"repository": "git@github.com:buildkite/example.git",
+		"cluster_id": "linux",
+		"step":       []interface{}{step("default"), step("windows")},
+	})
+	expected := "step.1: queue \"windows\" doesn't exist in cluster linux\n(the cluster has the queues: arm64, default)"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+
+	_, err = testClusterDiff(t, client, map[string]interface{}{
+		"name":          "test",
+		"repository":    "git@github.com:buildkite/example.git",
+		"cluster_id":    "linux",
+		"configuration": "steps:\n  - command: make\n    agents:\n      queue: macos\n",
+	})
+	if err == nil || !strings.Contains(err.Error(), `configuration step.0: queue "macos" doesn't exist`) {
+		t.Errorf("expected the configuration to be checked, got %v", err)
+	}
+
+	_, err = testClusterDiff(t, client, map[string]interface{}{
+		"name":       "test",
+		"repository": "git@github.com:buildkite/example.git",
+		"cluster_id": "missing",
+	})
+	if err == nil || !strings.Contains(err.Error(), `cluster "missing" doesn't exist`) {
+		t.Errorf("expected a missing cluster to be reported, got %v", err)
+	}
+}
+
+func TestReadClusterQueues_pages(t *testing.T) {
+	api := newTestAPI(t)
+	defer api.Close()
+
+	first := make([]string, 100)
+	for i := range first {
+		first[i] = fmt.Sprintf(`{"id": "%d", "key": "queue-%d"}`, i, i)
+	}
+	api.RespondPages("GET clusters/linux/queues", "["+strings.Join(first, ", ")+"]", `[{"id": "100", "key": "windows"}]`)
+
+	queues, err := readClusterQueues(api.client, "linux")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(queues) != 101 || !queues["queue-0"] || !queues["windows"] {
+		t.Errorf("expected the queues of both pages, got %d queues", len(queues))
+	}
+}
+
+func TestStepQueues(t *testing.T) {
+	steps := []Step{
+		{Type: "script", Agents: map[string]string{"queue": "default"}},
+		{Type: "group", Steps: []Step{
+			{Type: "script", AgentQueryRules: []string{"queue=arm64"}},
+			{Type: "script", Agents: map[string]string{"queue": "${QUEUE}"}},
+		}},
+	}
+	expected := map[string]string{"step.0": "default", "step.1.step.0": "arm64"}
+	if queues := stepQueues(steps, "step"); !reflect.DeepEqual(queues, expected) {
+		t.Errorf("got %v, want %v", queues, expected)
+	}
+}
@@ -0,0 +1,102 @@
+package buildkite
+
+import (
+	"fmt"
+	"reflect"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func validateYAML(v interface{}, k string) ([]string, []error) {
+	var doc interface{}
+	if err := yaml.Unmarshal([]byte(v.(string)), &doc); err != nil {
+		return nil, []error{fmt.Errorf("%s: invalid YAML: %s", k, err)}
+	}
+	return nil, nil
+}
+
+// validatePipelineConfiguration checks a YAML configuration against the
+// Buildkite pipeline schema. Unknown keys are only warnings here, as this
+// can't see configuration_unknown_keys; customizeDiffConfiguration turns them
+// into errors when asked to.
+func validatePipelineConfiguration(v interface{}, k string) ([]string, []error) {
+	if warnings, errs := validateYAML(v, k); len(errs) > 0 {
+		return warnings, errs
+	}
+
+	violations, err := validatePipelineSchema(v.(string))
+	if err != nil {
+		return nil, []error{fmt.Errorf("%s: %s", k, err)}
+	}
+
+	var warnings []string
+	var errs []error
+	for _, violation := range violations {
+		if violation.UnknownKey {
+			warnings = append(warnings, fmt.Sprintf("%s: %s", k, violation.Error()))
+		} else {
+			errs = append(errs, fmt.Errorf("%s: %s", k, violation.Error()))
+		}
+	}
+	return warnings, errs
+}
+
+// suppressEquivalentYAML ignores differences in formatting, comments, quoting
+// and key order between two YAML documents.
+func suppressEquivalentYAML(k, old, new string, d *schema.ResourceData) bool {
+	return yamlEquivalent(old, new)
+}
+
+func yamlEquivalent(a, b string) bool {
+	var docA, docB interface{}
+	if err := yaml.Unmarshal([]byte(a), &docA); err != nil {
+		return false
+	}
+	if err := yaml.Unmarshal([]byte(b), &docB); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(docA, docB)
+}
+
+// usesConfiguration decides whether a pipeline read from the API is managed
+// through its YAML configuration or through step blocks. Imported pipelines
+// have neither in state and follow what the API has.
+func usesConfiguration(d *schema.ResourceData, p *Pipeline) bool {
+	if d.Get("configuration").(string) != "" {
+		return true
+	}
+	if len(d.Get("step").([]interface{})) > 0 {
+		return false
+	}
+	return p.Configuration != ""
+}
+
+func customizeDiffConfiguration(d *schema.ResourceDiff, meta interface{}) error {
+	if !d.NewValueKnown("configuration") || !d.NewValueKnown("step") {
+		return nil
+	}
+	configuration := d.Get("configuration").(string)
+	if configuration == "" && len(d.Get("step").([]interface{})) == 0 {
+		return fmt.Errorf("one of configuration or step must be set")
+	}
+
+	if configuration == "" || d.Get("configuration_unknown_keys").(string) != "error" {
+		return nil
+	}
+	violations, err := validatePipelineSchema(configuration)
+	if err != nil {
+		return fmt.Errorf("configuration: %s", err)
+	}
+	var unknown []string
+	for _, violation := range violations {
+		if violation.UnknownKey {
+			unknown = append(unknown, violation.Error())
+		}
+	}
+	if len(unknown) > 0 {
+		return fmt.Errorf("configuration has unknown keys:\n  %s", strings.Join(unknown, "\n  "))
+	}
+	return nil
+}
@@ -0,0 +1,103 @@
+package buildkite
+
+import (
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestYAMLEquivalent(t *testing.T) {
+	cases := []struct {
+		A, B       string
+		Equivalent bool
+	}{
+		{
+			A:          "steps:\n  - command: make\n    label: build\n",
+			B:          "# build it\nsteps:\n- label: \"build\"\n  command: 'make'\n",
+			Equivalent: true,
+		},
+		{
+			A:          "steps:\n  - command: make\n",
+			B:          "steps: [{command: make}]",
+			Equivalent: true,
+		},
+		{
+			A:          "steps:\n  - command: make\n",
+			B:          "steps:\n  - command: make test\n",
+			Equivalent: false,
+		},
+		{
+			A:          "steps:\n  - wait\n  - command: make\n",
+			B:          "steps:\n  - command: make\n  - wait\n",
+			Equivalent: false,
+		},
+		{
+			A:          "steps: [",
+			B:          "steps: [",
+			Equivalent: false,
+		},
+	}
+
+	for _, tc := range cases {
+		if actual := yamlEquivalent(tc.A, tc.B); actual != tc.Equivalent {
+			t.Errorf("yamlEquivalent(%q, %q) = %t, want %t", tc.A, tc.B, actual, tc.Equivalent)
+		}
+	}
+}
+
+func TestValidateYAML(t *testing.T) {
+	if _, errs := validateYAML("steps:\n  - command: make\n", "configuration"); len(errs) > 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if _, errs := validateYAML("steps:\n  - command: make\n   label: x", "configuration"); len(errs) == 0 {
+		t.Errorf("expected an error for invalid YAML")
+	}
+}
+
+func TestUpdatePipelineFromAPI_importConfiguration(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourcePipeline().Schema, map[string]interface{}{})
+	p := &Pipeline{
+		Slug:          "imported",
+		Configuration: "steps:\n  - command: make\n",
+		Steps: []Step{
+			{Type: "script", Command: "make"},
+		},
+	}
+
+	if err := updatePipelineFromAPI(d, p, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Get("configuration").(string) != p.Configuration {
+		t.Errorf("expected configuration to be imported, got %q", d.Get("configuration"))
+	}
+	if steps := d.Get("step").([]interface{}); len(steps) != 0 {
+		t.Errorf("expected no steps for a YAML pipeline, got %d", len(steps))
+	}
+}
+
+func TestUpdatePipelineFromAPI_keepsSteps(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourcePipeline().Schema, map[string]interface{}{
+		"step": []interface{}{
+			map[string]interface{}{"type": "script", "command": "make"},
+		},
+	})
+	p := &Pipeline{
+		Slug:          "steps",
+		Configuration: "steps:\n  - command: make\n",
+		Steps: []Step{
+			{Type: "script", Command: "make"},
+		},
+	}
+
+	if err := updatePipelineFromAPI(d, p, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if d.Get("configuration").(string) != "" {
+		t.Errorf("expected no configuration, got %q", d.Get("configuration"))
+	}
+	if steps := d.Get("step").([]interface{}); len(steps) != 1 {
+		t.Errorf("expected 1 step, got %d", len(steps))
+	}
+}
@@ -0,0 +1,233 @@
+package buildkite
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Steps returned by the API may have fields the step schema doesn't model,
+// e.g. plugins, retry or soft_fail. As updates replace the whole list of
+// steps, these are kept in extra_json and sent back as they were. Pipelines
+// keep theirs in the same way, so settings made in the UI can be managed.
+
+var stepJSONFields = jsonFieldNames(reflect.TypeOf(Step{}))
+
+var pipelineJSONFields = jsonFieldNames(reflect.TypeOf(Pipeline{}), pipelineReadOnlyFields...)
+
+// pipelineReadOnlyFields are returned by the API without being in Pipeline,
+// and can't be sent back. Read only fields the API adds later end up in
+// extra_json until they are listed here, and are sent back on update.
+var pipelineReadOnlyFields = []string{"created_by", "running_jobs_count", "scheduled_jobs_count", "waiting_jobs_count"}
+
+// pipelineJSON has the fields of Pipeline without its JSON methods.
+type pipelineJSON Pipeline
+
+func (p Pipeline) MarshalJSON() ([]byte, error) {
+	return marshalWithExtra(pipelineJSON(p), p.Extra)
+}
+
+func (p *Pipeline) UnmarshalJSON(data []byte) error {
+	var raw pipelineJSON
+	extra, err := unmarshalWithExtra(data, &raw, pipelineJSONFields)
+	if err != nil {
+		return err
+	}
+	*p = Pipeline(raw)
+	p.Extra = extra
+	return nil
+}
+
+// stepJSON has the fields of Step without its JSON methods.
+type stepJSON Step
+
+func (s Step) MarshalJSON() ([]byte, error) {
+	return marshalWithExtra(stepJSON(s), s.Extra)
+}
+
+func (s *Step) UnmarshalJSON(data []byte) error {
+	var raw stepJSON
+	extra, err := unmarshalWithExtra(data, &raw, stepJSONFields)
+	if err != nil {
+		return err
+	}
+	*s = Step(raw)
+	s.Extra = extra
+	return nil
+}
+
+// jsonFieldNames returns the JSON names of the fields of a struct type, along
+// with any other names given.
+func jsonFieldNames(t reflect.Type, other ...string) map[string]bool {
+	names := map[string]bool{}
+	for _, name := range other {
+		names[name] = true
+	}
+	for i := 0; i < t.NumField(); i++ {
+		name := strings.Split(t.Field(i).Tag.Get("json"), ",")[0]
+		if name != "" && name != "-" {
+			names[name] = true
+		}
+	}
+	return names
+}
+
+// unmarshalWithExtra decodes data into v and returns the fields which aren't
+// in known.
+func unmarshalWithExtra(data []byte, v interface{}, known map[string]bool) (map[string]json.RawMessage, error) {
+	if err := json.Unmarshal(data, v); err != nil {
+		return nil, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+
+	var extra map[string]json.RawMessage
+	for k, raw := range all {
+		if known[k] {
+			continue
+		}
+		if extra == nil {
+			extra = map[string]json.RawMessage{}
+		}
+		extra[k] = raw
+	}
+	return extra, nil
+}
+
+// marshalWithExtra encodes v along with extra fields. Fields of v win over
+// extra fields of the same name.
+func marshalWithExtra(v interface{}, extra map[string]json.RawMessage) ([]byte, error) {
+	data, err := json.Marshal(v)
+	if err != nil || len(extra) == 0 {
+		return data, err
+	}
+
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	for k, raw := range extra {
+		if _, ok := all[k]; !ok {
+			all[k] = raw
+		}
+	}
+	return json.Marshal(all)
+}
+
+func expandExtraJSON(s string) map[string]json.RawMessage {
+	if s == "" {
+		return nil
+	}
+	var extra map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(s), &extra); err != nil {
+		// Rejected by validateExtraJSON at plan time
+		return nil
+	}
+	return extra
+}
+
+// flattenExtraJSON encodes extra fields as a JSON object with sorted keys,
+// keeping the prior value when it is equivalent.
+func flattenExtraJSON(extra map[string]json.RawMessage, priorI interface{}) string {
+	if len(extra) == 0 {
+		return ""
+	}
+	data, err := json.Marshal(extra)
+	if err != nil {
+		return ""
+	}
+	if prior, ok := priorI.(string); ok && jsonEquivalent(prior, string(data)) {
+		return prior
+	}
+	return string(data)
+}
+
+func extraFieldNames(extra map[string]json.RawMessage) []string {
+	names := make([]string, 0, len(extra))
+	for k := range extra {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// extraFieldPaths lists the fields kept in the extra_json of the pipeline and
+// its steps, e.g. step.0.plugins, so they can be seen in state and plans.
+func extraFieldPaths(get func(string) interface{}) []string {
+	paths := extraFieldNames(expandExtraJSON(get("extra_json").(string)))
+	walkSteps(get("step").([]interface{}), "step", func(stepM map[string]interface{}, path string) error {
+		extra, _ := stepM["extra_json"].(string)
+		for _, name := range extraFieldNames(expandExtraJSON(extra)) {
+			paths = append(paths, path+"."+name)
+		}
+		return nil
+	})
+	return paths
+}
+
+func customizeDiffExtraFields(d *schema.ResourceDiff, meta interface{}) error {
+	known := d.NewValueKnown("extra_json") && d.NewValueKnown("step")
+	walkSteps(d.Get("step").([]interface{}), "step", func(stepM map[string]interface{}, path string) error {
+		known = known && d.NewValueKnown(path+".extra_json")
+		return nil
+	})
+	if !known {
+		return d.SetNewComputed("extra_fields")
+	}
+
+	paths := extraFieldPaths(d.Get)
+	prior := []string{}
+	for _, vI := range d.Get("extra_fields").([]interface{}) {
+		prior = append(prior, vI.(string))
+	}
+	if !reflect.DeepEqual(paths, prior) {
+		return d.SetNew("extra_fields", paths)
+	}
+	return nil
+}
+
+// validateExtraJSON returns a validation function for extra_json, which
+// rejects the fields in known.
+func validateExtraJSON(known map[string]bool) schema.SchemaValidateFunc {
+	return func(v interface{}, k string) ([]string, []error) {
+		s := v.(string)
+		if s == "" {
+			return nil, nil
+		}
+
+		var extra map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(s), &extra); err != nil {
+			return nil, []error{fmt.Errorf("%s: must be a JSON object: %s", k, err)}
+		}
+
+		var errs []error
+		for _, name := range extraFieldNames(extra) {
+			if known[name] {
+				errs = append(errs, fmt.Errorf("%s: %q has an attribute or is read only, so can't be set in extra_json", k, name))
+			}
+		}
+		return nil, errs
+	}
+}
+
+func suppressEquivalentJSON(k, old, new string, d *schema.ResourceData) bool {
+	return jsonEquivalent(old, new)
+}
+
+func jsonEquivalent(a, b string) bool {
+	var docA, docB interface{}
+	if err := json.Unmarshal([]byte(a), &docA); err != nil {
+		return false
+	}
+	if err := json.Unmarshal([]byte(b), &docB); err != nil {
+		return false
+	}
+	return reflect.DeepEqual(docA, docB)
+}
@@ -0,0 +1,136 @@
+package buildkite
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+const testStepsJSON = `[
+  {
+    "type": "script",
+    "name": "test",
+    "command": "make test",
+    "plugins": [{"docker#v5.9.0": {"image": "golang"}}],
+    "retry": {"automatic": {"limit": 2}}
+  },
+  {
+    "type": "group",
+    "group": "deploy",
+    "allow_dependency_failure": true,
+    "steps": [
+      {"type": "script", "command": "make deploy", "soft_fail": true}
+    ]
+  }
+]`
+
+func TestStepJSON_extraFields(t *testing.T) {
+	var steps []Step
+	if err := json.Unmarshal([]byte(testStepsJSON), &steps); err != nil {
+		t.Fatal(err)
+	}
+
+	if names := extraFieldNames(steps[0].Extra); len(names) != 2 || names[0] != "plugins" || names[1] != "retry" {
+		t.Errorf("unexpected extra fields %v", names)
+	}
+	if steps[0].Command != "make test" {
+		t.Errorf("expected known fields to be read, got %#v", steps[0])
+	}
+
+	data, err := json.Marshal(steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !jsonEquivalent(string(data), testStepsJSON) {
+		t.Errorf("expected steps to round trip, got %s", data)
+	}
+}
+
+// Steps read from the API are sent back with the fields the schema can't
+// represent, so updates don't lose configuration made in the UI.
+func TestUpdatePipelineFromAPI_extraFields(t *testing.T) {
+	p := &Pipeline{Slug: "imported"}
+	if err := json.Unmarshal([]byte(`{"steps": `+testStepsJSON+`}`), p); err != nil {
+		t.Fatal(err)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourcePipeline().Schema, map[string]interface{}{
+		"step": []interface{}{
+			map[string]interface{}{"type": "script", "name": "test", "command": "make test"},
+		},
+	})
+	if err := updatePipelineFromAPI(d, p, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := `{"plugins":[{"docker#v5.9.0":{"image":"golang"}}],"retry":{"automatic":{"limit":2}}}`
+	if actual := d.Get("step.0.extra_json").(string); actual != expected {
+		t.Errorf("got %s, want %s", actual, expected)
+	}
+	if actual := d.Get("step.1.step.0.extra_json").(string); actual != `{"soft_fail":true}` {
+		t.Errorf("unexpected nested extra_json %s", actual)
+	}
+
+	req := preparePipelineRequestPayload(d)
+	data, err := json.Marshal(req.Steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !jsonEquivalent(string(data), testStepsJSON) {
+		t.Errorf("expected steps to be sent back as read, got %s", data)
+	}
+}
+
+func TestValidateExtraJSON(t *testing.T) {
+	validate := validateExtraJSON(stepJSONFields)
+	if _, errs := validate(`{"plugins": []}`, "step.0.extra_json"); len(errs) > 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if _, errs := validate(`["plugins"]`, "step.0.extra_json"); len(errs) == 0 {
+		t.Errorf("expected an error for a JSON list")
+	}
+	if _, errs := validate(`{"command": "make"}`, "step.0.extra_json"); len(errs) == 0 {
+		t.Errorf("expected an error for a field with an attribute")
+	}
+
+	validate = validateExtraJSON(pipelineJSONFields)
+	if _, errs := validate(`{"allow_rebuilds": false}`, "extra_json"); len(errs) > 0 {
+		t.Errorf("unexpected errors: %v", errs)
+	}
+	if _, errs := validate(`{"waiting_jobs_count": 0}`, "extra_json"); len(errs) == 0 {
+		t.Errorf("expected an error for a read only field")
+	}
+}
+
+func TestUpdatePipelineFromAPI_extraPipelineFields(t *testing.T) {
+	p := &Pipeline{}
+	data := `{"slug": "imported", "allow_rebuilds": false, "waiting_jobs_count": 2, "steps": ` + testStepsJSON + `}`
+	if err := json.Unmarshal([]byte(data), p); err != nil {
+		t.Fatal(err)
+	}
+
+	d := schema.TestResourceDataRaw(t, resourcePipeline().Schema, map[string]interface{}{})
+	if err := updatePipelineFromAPI(d, p, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if actual := d.Get("extra_json").(string); actual != `{"allow_rebuilds":false}` {
+		t.Errorf("unexpected pipeline extra_json %s", actual)
+	}
+
+	expected := []interface{}{"allow_rebuilds", "step.0.plugins", "step.0.retry", "step.1.allow_dependency_failure", "step.1.step.0.soft_fail"}
+	if actual := d.Get("extra_fields").([]interface{}); !reflect.DeepEqual(actual, expected) {
+		t.Errorf("got extra_fields %v, want %v", actual, expected)
+	}
+
+	out, err := json.Marshal(preparePipelineRequestPayload(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(out), `"allow_rebuilds":false`) || strings.Contains(string(out), "waiting_jobs_count") {
+		t.Errorf("expected only the writable extra fields to be sent, got %s", out)
+	}
+}
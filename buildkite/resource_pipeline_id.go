@@ -0,0 +1,161 @@
+package buildkite
+
+import (
+	"fmt"
+	"log"
+	"net/url"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Pipelines are keyed on their UUID, as the slug changes when a pipeline is
+// renamed. Requests still go through the slug, so a pipeline which can't be
+// found by its slug is looked up by its UUID.
+
+var uuidRegexp = regexp.MustCompile(`^[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}$`)
+
+// pipelineSlug returns the slug the pipeline currently has, which during an
+// update is the one in state.
+func pipelineSlug(d *schema.ResourceData) string {
+	slug, _ := d.GetChange("slug")
+	if s, _ := slug.(string); s != "" {
+		return s
+	}
+	// State from before pipelines were keyed on their UUID
+	return d.Id()
+}
+
+// findPipeline reads a pipeline by its slug, falling back to looking for its
+// UUID when the slug is gone or belongs to another pipeline.
+func findPipeline(client *Client, id, slug string) (*Pipeline, error) {
+	if slug != "" {
+		res := &Pipeline{}
+		err := client.Get([]string{"pipelines", slug}, res)
+		if err == nil && (!uuidRegexp.MatchString(id) || res.Id == id) {
+			return res, nil
+		}
+		if _, ok := err.(*notFound); err != nil && !ok {
+			return nil, err
+		}
+	}
+	if !uuidRegexp.MatchString(id) {
+		return nil, &notFound{}
+	}
+
+	log.Printf("[INFO] buildkite: Pipeline %s isn't at %q any more, looking it up by its UUID", id, slug)
+	for page := 1; ; page++ {
+		var res []*Pipeline
+		query := url.Values{
+			"per_page": []string{"100"},
+			"page":     []string{strconv.Itoa(page)},
+		}
+		if err := client.GetQuery([]string{"pipelines"}, query, &res); err != nil {
+			return nil, err
+		}
+		for _, p := range res {
+			if p.Id == id {
+				return p, nil
+			}
+		}
+		if len(res) < 100 {
+			return nil, &notFound{}
+		}
+	}
+}
+
+// parsePipelineImportID accepts a UUID, a slug, or the URL of a pipeline,
+// and returns either its UUID or its slug.
+func parsePipelineImportID(importID string) (id, slug string, err error) {
+	if uuidRegexp.MatchString(importID) {
+		return importID, "", nil
+	}
+	if !strings.Contains(importID, "/") {
+		return "", importID, nil
+	}
+
+	u, err := url.Parse(importID)
+	if err != nil || u.Host == "" {
+		return "", "", fmt.Errorf("%q isn't a pipeline slug, UUID or URL", importID)
+	}
+	parts := strings.Split(strings.Trim(u.Path, "/"), "/")
+	for i, part := range parts {
+		// API URLs: /v2/organizations/org/pipelines/slug
+		if part == "pipelines" && i+1 < len(parts) {
+			return "", parts[i+1], nil
+		}
+	}
+	// Web URLs: /org/slug, possibly followed by /builds/1 and the like
+	if len(parts) >= 2 && parts[1] != "" {
+		return "", parts[1], nil
+	}
+	return "", "", fmt.Errorf("%q isn't the URL of a pipeline", importID)
+}
+
+func resourcePipelineImport(d *schema.ResourceData, meta interface{}) ([]*schema.ResourceData, error) {
+	client := meta.(*Client)
+
+	id, slug, err := parsePipelineImportID(d.Id())
+	if err != nil {
+		return nil, err
+	}
+	p, err := findPipeline(client, id, slug)
+	if _, ok := err.(*notFound); ok {
+		return nil, fmt.Errorf("pipeline %q doesn't exist", d.Id())
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	d.SetId(p.Id)
+	d.Set("slug", p.Slug)
+
+	// Settings are only read into blocks in use, so the block of the
+	// provider is filled in here
+	if p.Provider != nil {
+		if attr, settings := p.Provider.settings(); attr != "" {
+			d.Set(attr, flattenProviderSettings(settings))
+		}
+	}
+	return []*schema.ResourceData{d}, nil
+}
+
+// customizeDiffSlug shows the slug as changing along with the name, unless
+// it is pinned or changed as well.
+func customizeDiffSlug(d *schema.ResourceDiff, meta interface{}) error {
+	if d.Id() == "" || !d.HasChange("name") || d.HasChange("slug") || d.Get("pin_slug").(bool) {
+		return nil
+	}
+	return d.SetNewComputed("slug")
+}
+
+// resourcePipelineStateUpgradeV1 moves state keyed on the slug to the UUID
+// of the pipeline. Without a configured provider the ID is left as it is,
+// and replaced by the next read.
+func resourcePipelineStateUpgradeV1(rawState map[string]interface{}, meta interface{}) (map[string]interface{}, error) {
+	log.Printf("[INFO] buildkite: Upgrading pipeline state from version 1")
+
+	id, _ := rawState["id"].(string)
+	if id == "" || uuidRegexp.MatchString(id) {
+		return rawState, nil
+	}
+	if slug, _ := rawState["slug"].(string); slug == "" {
+		rawState["slug"] = id
+	}
+
+	client, ok := meta.(*Client)
+	if !ok {
+		return rawState, nil
+	}
+	p, err := findPipeline(client, "", rawState["slug"].(string))
+	if _, ok := err.(*notFound); ok {
+		return rawState, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	rawState["id"] = p.Id
+	return rawState, nil
+}
@@ -0,0 +1,135 @@
+package buildkite
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+const testPipelineUUID = "0b8c7f2e-6a4c-4f1e-9a73-3d0e2f4b5c6d"
+
+// testPipelinesAPI serves one pipeline, which was renamed from old-name to
+// new-name, and another pipeline which took over old-name.
+func testPipelinesAPI(t *testing.T) *testAPI {
+	api := newTestAPI(t)
+	api.Respond("GET pipelines/new-name", fmt.Sprintf(`{"id": %q, "slug": "new-name"}`, testPipelineUUID))
+	api.Respond("GET pipelines/old-name", `{"id": "f3c1e2d4-0000-4000-8000-000000000000", "slug": "old-name"}`)
+	api.RespondPages("GET pipelines", fmt.Sprintf(`[{"id": "f3c1e2d4-0000-4000-8000-000000000000", "slug": "old-name"}, {"id": %q, "slug": "new-name"}]`, testPipelineUUID))
+	return api
+}
+
+func TestFindPipeline(t *testing.T) {
+	api := testPipelinesAPI(t)
+	defer api.Close()
+	client := api.client
+
+	for _, tc := range []struct {
+		id, slug string
+		expected string
+	}{
+		{testPipelineUUID, "new-name", "new-name"},
+		{testPipelineUUID, "old-name", "new-name"},
+		{testPipelineUUID, "gone", "new-name"},
+		{"", "old-name", "old-name"},
+		{"old-name", "old-name", "old-name"},
+	} {
+		p, err := findPipeline(client, tc.id, tc.slug)
+		if err != nil {
+			t.Errorf("%s %s: %s", tc.id, tc.slug, err)
+			continue
+		}
+		if p.Slug != tc.expected {
+			t.Errorf("%s %s: got %s, want %s", tc.id, tc.slug, p.Slug, tc.expected)
+		}
+	}
+
+	if _, err := findPipeline(client, "f3c1e2d4-1111-4000-8000-000000000000", "gone"); err == nil {
+		t.Errorf("expected a missing pipeline to be reported")
+	} else if _, ok := err.(*notFound); !ok {
+		t.Errorf("expected not found, got %s", err)
+	}
+}
+
+func TestParsePipelineImportID(t *testing.T) {
+	for importID, expected := range map[string][2]string{
+		testPipelineUUID: {testPipelineUUID, ""},
+		"my-pipeline":    {"", "my-pipeline"},
+		"https://buildkite.com/my-org/my-pipeline":                                {"", "my-pipeline"},
+		"https://buildkite.com/my-org/my-pipeline/builds/12":                      {"", "my-pipeline"},
+		"https://api.buildkite.com/v2/organizations/my-org/pipelines/my-pipeline": {"", "my-pipeline"},
+	} {
+		id, slug, err := parsePipelineImportID(importID)
+		if err != nil {
+			t.Errorf("%s: %s", importID, err)
+			continue
+		}
+		if actual := [2]string{id, slug}; actual != expected {
+			t.Errorf("%s: got %v, want %v", importID, actual, expected)
+		}
+	}
+
+	for _, importID := range []string{"https://buildkite.com/my-org", "my-org/my-pipeline"} {
+		if _, _, err := parsePipelineImportID(importID); err == nil {
+			t.Errorf("%s: expected an error", importID)
+		}
+	}
+}
+
+func TestResourcePipelineStateUpgradeV1(t *testing.T) {
+	api := testPipelinesAPI(t)
+	defer api.Close()
+	client := api.client
+
+	for _, tc := range []struct {
+		meta     interface{}
+		expected map[string]interface{}
+	}{
+		{client, map[string]interface{}{"id": testPipelineUUID, "slug": "new-name"}},
+		{nil, map[string]interface{}{"id": "new-name", "slug": "new-name"}},
+	} {
+		actual, err := resourcePipelineStateUpgradeV1(map[string]interface{}{"id": "new-name"}, tc.meta)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(actual, tc.expected) {
+			t.Errorf("got %v, want %v", actual, tc.expected)
+		}
+	}
+}
+
+func TestCustomizeDiffSlug(t *testing.T) {
+	r := resourcePipeline()
+	step := map[string]interface{}{"type": "script", "command": "make"}
+
+	old := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"name":       "old name",
+		"slug":       "old-name",
+		"repository": "git@github.com:buildkite/example.git",
+		"step":       []interface{}{step},
+	})
+	old.SetId(testPipelineUUID)
+	state := old.State()
+
+	for _, pinned := range []bool{false, true} {
+		c := map[string]interface{}{
+			"name":       "new name",
+			"repository": "git@github.com:buildkite/example.git",
+			"step":       []interface{}{step},
+		}
+		if pinned {
+			c["pin_slug"] = true
+		}
+		d, diff := testPipelineUpdate(t, state, c, nil)
+
+		attr := diff.Attributes["slug"]
+		if computed := attr != nil && attr.NewComputed; computed == pinned {
+			t.Errorf("pinned %v: expected slug to be computed only when not pinned, got %#v", pinned, attr)
+		}
+		slug, sent := preparePipelineUpdatePayload(d)["slug"]
+		if sent != pinned || (pinned && slug != "old-name") {
+			t.Errorf("pinned %v: got slug %v in the update", pinned, slug)
+		}
+	}
+}
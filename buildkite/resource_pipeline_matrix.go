@@ -0,0 +1,469 @@
+package buildkite
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func matrixSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		MaxItems: 1,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				// Single-dimension matrix: a plain list of values
+				"values": &schema.Schema{
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem: &schema.Schema{
+						Type: schema.TypeString,
+					},
+				},
+				// Multi-dimension matrix: one block per dimension
+				"setup": &schema.Schema{
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"name": &schema.Schema{
+								Type:     schema.TypeString,
+								Required: true,
+							},
+							"values": &schema.Schema{
+								Type:     schema.TypeList,
+								Required: true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+						},
+					},
+				},
+				"adjustment": &schema.Schema{
+					Type:     schema.TypeList,
+					Optional: true,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							// Used by multi-dimension matrices
+							"with": &schema.Schema{
+								Type:     schema.TypeMap,
+								Optional: true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+							// Used by single-dimension matrices
+							"value": &schema.Schema{
+								Type:     schema.TypeString,
+								Optional: true,
+							},
+							"skip": &schema.Schema{
+								Type:     schema.TypeString,
+								Optional: true,
+							},
+							"soft_fail": &schema.Schema{
+								Type:     schema.TypeBool,
+								Optional: true,
+							},
+							// Exit statuses which soft fail, "*" for any
+							"soft_fail_exit_statuses": &schema.Schema{
+								Type:     schema.TypeList,
+								Optional: true,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+// Matrix is a step build matrix. Exactly one of Values (single dimension)
+// or Setup (multiple named dimensions) is populated.
+type Matrix struct {
+	Values      []string
+	Setup       map[string][]string
+	Adjustments []MatrixAdjustment
+}
+
+// MatrixAdjustment changes the jobs for one combination of the matrix. The
+// API accepts soft_fail as a boolean or a list of exit statuses, which are
+// kept in SoftFailExitStatuses so they aren't lost.
+type MatrixAdjustment struct {
+	With                 map[string]string
+	Value                string
+	Skip                 skipValue
+	SoftFail             bool
+	SoftFailExitStatuses []string
+}
+
+// skipValue is either "true", "false"/"" or a free text reason, mirroring
+// the API which accepts a boolean or a string.
+type skipValue string
+
+func (s skipValue) MarshalJSON() ([]byte, error) {
+	switch s {
+	case "", "false":
+		return []byte("false"), nil
+	case "true":
+		return []byte("true"), nil
+	}
+	return json.Marshal(string(s))
+}
+
+func (s *skipValue) UnmarshalJSON(data []byte) error {
+	var v interface{}
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+
+	switch t := v.(type) {
+	case bool:
+		if t {
+			*s = "true"
+		} else {
+			*s = ""
+		}
+	case string:
+		*s = skipValue(t)
+	case nil:
+		*s = ""
+	default:
+		return fmt.Errorf("unexpected skip value %s", string(data))
+	}
+	return nil
+}
+
+type matrixJSON struct {
+	Setup       interface{}        `json:"setup"`
+	Adjustments []MatrixAdjustment `json:"adjustments,omitempty"`
+}
+
+func (m Matrix) MarshalJSON() ([]byte, error) {
+	if len(m.Setup) == 0 {
+		if len(m.Adjustments) == 0 {
+			return json.Marshal(m.Values)
+		}
+		return json.Marshal(matrixJSON{Setup: m.Values, Adjustments: m.Adjustments})
+	}
+	return json.Marshal(matrixJSON{Setup: m.Setup, Adjustments: m.Adjustments})
+}
+
+func (m *Matrix) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	switch t := raw.(type) {
+	case []interface{}:
+		m.Values = stringifyList(t)
+		return nil
+	case map[string]interface{}:
+	default:
+		return fmt.Errorf("unexpected matrix value %s", string(data))
+	}
+
+	var obj struct {
+		Setup       interface{}        `json:"setup"`
+		Adjustments []MatrixAdjustment `json:"adjustments"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	m.Adjustments = obj.Adjustments
+
+	switch setup := obj.Setup.(type) {
+	case []interface{}:
+		m.Values = stringifyList(setup)
+	case map[string]interface{}:
+		m.Setup = make(map[string][]string, len(setup))
+		for k, vI := range setup {
+			values, ok := vI.([]interface{})
+			if !ok {
+				return fmt.Errorf("unexpected values for matrix dimension %q", k)
+			}
+			m.Setup[k] = stringifyList(values)
+		}
+	}
+	return nil
+}
+
+func (a MatrixAdjustment) MarshalJSON() ([]byte, error) {
+	out := map[string]interface{}{}
+	if len(a.With) > 0 {
+		out["with"] = a.With
+	} else {
+		out["with"] = a.Value
+	}
+	if a.Skip != "" && a.Skip != "false" {
+		out["skip"] = a.Skip
+	}
+	if len(a.SoftFailExitStatuses) > 0 {
+		statuses := make([]interface{}, len(a.SoftFailExitStatuses))
+		for i, status := range a.SoftFailExitStatuses {
+			if n, err := strconv.Atoi(status); err == nil {
+				statuses[i] = map[string]interface{}{"exit_status": n}
+			} else {
+				statuses[i] = map[string]interface{}{"exit_status": status}
+			}
+		}
+		out["soft_fail"] = statuses
+	} else if a.SoftFail {
+		out["soft_fail"] = true
+	}
+	return json.Marshal(out)
+}
+
+func (a *MatrixAdjustment) UnmarshalJSON(data []byte) error {
+	var obj struct {
+		With     interface{} `json:"with"`
+		Skip     skipValue   `json:"skip"`
+		SoftFail interface{} `json:"soft_fail"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	switch with := obj.With.(type) {
+	case map[string]interface{}:
+		a.With = make(map[string]string, len(with))
+		for k, vI := range with {
+			a.With[k] = stringifyScalar(vI)
+		}
+	case nil:
+	default:
+		a.Value = stringifyScalar(with)
+	}
+	a.Skip = obj.Skip
+	switch sf := obj.SoftFail.(type) {
+	case bool:
+		a.SoftFail = sf
+	case []interface{}:
+		for _, statusI := range sf {
+			statusM, ok := statusI.(map[string]interface{})
+			if !ok {
+				return fmt.Errorf("unexpected soft_fail value %s", string(data))
+			}
+			a.SoftFailExitStatuses = append(a.SoftFailExitStatuses, stringifyScalar(statusM["exit_status"]))
+		}
+	case nil:
+	default:
+		return fmt.Errorf("unexpected soft_fail value %s", string(data))
+	}
+	return nil
+}
+
+func stringifyScalar(v interface{}) string {
+	switch t := v.(type) {
+	case string:
+		return t
+	case float64:
+		return strconv.FormatFloat(t, 'f', -1, 64)
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+func stringifyList(l []interface{}) []string {
+	out := make([]string, len(l))
+	for i, vI := range l {
+		out[i] = stringifyScalar(vI)
+	}
+	return out
+}
+
+func expandMatrix(matrixI []interface{}) *Matrix {
+	if len(matrixI) == 0 || matrixI[0] == nil {
+		return nil
+	}
+	matrixM := matrixI[0].(map[string]interface{})
+	m := &Matrix{}
+
+	for _, vI := range matrixM["values"].([]interface{}) {
+		m.Values = append(m.Values, vI.(string))
+	}
+
+	if setup := matrixM["setup"].([]interface{}); len(setup) > 0 {
+		m.Setup = map[string][]string{}
+		for _, dimI := range setup {
+			dimM := dimI.(map[string]interface{})
+			values := []string{}
+			for _, vI := range dimM["values"].([]interface{}) {
+				values = append(values, vI.(string))
+			}
+			m.Setup[dimM["name"].(string)] = values
+		}
+	}
+
+	for _, adjI := range matrixM["adjustment"].([]interface{}) {
+		adjM := adjI.(map[string]interface{})
+		adj := MatrixAdjustment{
+			Value:    adjM["value"].(string),
+			Skip:     skipValue(adjM["skip"].(string)),
+			SoftFail: adjM["soft_fail"].(bool),
+		}
+		for _, statusI := range adjM["soft_fail_exit_statuses"].([]interface{}) {
+			adj.SoftFailExitStatuses = append(adj.SoftFailExitStatuses, statusI.(string))
+		}
+		if with := adjM["with"].(map[string]interface{}); len(with) > 0 {
+			adj.With = map[string]string{}
+			for k, vI := range with {
+				adj.With[k] = vI.(string)
+			}
+		}
+		m.Adjustments = append(m.Adjustments, adj)
+	}
+
+	return m
+}
+
+// flattenMatrix converts a matrix into state. The API doesn't keep the order
+// of dimensions, so the order of the prior state is kept and any other
+// dimensions are sorted by name.
+func flattenMatrix(m *Matrix, priorI interface{}) []interface{} {
+	if m == nil {
+		return []interface{}{}
+	}
+
+	names := make([]string, 0, len(m.Setup))
+	if prior, ok := priorI.([]interface{}); ok && len(prior) > 0 && prior[0] != nil {
+		setupI, _ := prior[0].(map[string]interface{})["setup"].([]interface{})
+		for _, dimI := range setupI {
+			dimM, ok := dimI.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			if name, _ := dimM["name"].(string); m.Setup[name] != nil && !containsString(names, name) {
+				names = append(names, name)
+			}
+		}
+	}
+	remaining := []string{}
+	for name := range m.Setup {
+		if !containsString(names, name) {
+			remaining = append(remaining, name)
+		}
+	}
+	sort.Strings(remaining)
+	names = append(names, remaining...)
+
+	setup := make([]interface{}, len(names))
+	for i, name := range names {
+		setup[i] = map[string]interface{}{
+			"name":   name,
+			"values": m.Setup[name],
+		}
+	}
+
+	adjustments := make([]interface{}, len(m.Adjustments))
+	for i, adj := range m.Adjustments {
+		adjustments[i] = map[string]interface{}{
+			"with":                    adj.With,
+			"value":                   adj.Value,
+			"skip":                    string(adj.Skip),
+			"soft_fail":               adj.SoftFail,
+			"soft_fail_exit_statuses": adj.SoftFailExitStatuses,
+		}
+	}
+
+	return []interface{}{
+		map[string]interface{}{
+			"values":     m.Values,
+			"setup":      setup,
+			"adjustment": adjustments,
+		},
+	}
+}
+
+// validateMatrix checks that a matrix has exactly one shape and that every
+// adjustment refers to dimensions and values that exist in the setup.
+func validateMatrix(m *Matrix) error {
+	if len(m.Values) > 0 && len(m.Setup) > 0 {
+		return fmt.Errorf("only one of values or setup may be set")
+	}
+	if len(m.Values) == 0 && len(m.Setup) == 0 {
+		return fmt.Errorf("one of values or setup must be set")
+	}
+
+	for i, adj := range m.Adjustments {
+		if adj.SoftFail && len(adj.SoftFailExitStatuses) > 0 {
+			return fmt.Errorf("adjustment.%d: only one of soft_fail or soft_fail_exit_statuses may be set", i)
+		}
+		for _, status := range adj.SoftFailExitStatuses {
+			if _, err := strconv.Atoi(status); err != nil && status != "*" {
+				return fmt.Errorf("adjustment.%d: soft_fail_exit_statuses: %q must be an exit status or *", i, status)
+			}
+		}
+
+		if len(m.Setup) == 0 {
+			if len(adj.With) > 0 {
+				return fmt.Errorf("adjustment.%d: with is only valid for a matrix with setup, use value instead", i)
+			}
+			if !containsString(m.Values, adj.Value) {
+				return fmt.Errorf("adjustment.%d: value %q is not one of the matrix values", i, adj.Value)
+			}
+			continue
+		}
+
+		if adj.Value != "" {
+			return fmt.Errorf("adjustment.%d: value is only valid for a matrix with values, use with instead", i)
+		}
+		if len(adj.With) == 0 {
+			return fmt.Errorf("adjustment.%d: with must be set", i)
+		}
+
+		dims := make([]string, 0, len(adj.With))
+		for dim := range adj.With {
+			dims = append(dims, dim)
+		}
+		sort.Strings(dims)
+
+		for _, dim := range dims {
+			values, ok := m.Setup[dim]
+			if !ok {
+				return fmt.Errorf("adjustment.%d: dimension %q is not in the matrix setup", i, dim)
+			}
+			if !containsString(values, adj.With[dim]) {
+				return fmt.Errorf("adjustment.%d: value %q is not one of the values of dimension %q (%s)",
+					i, adj.With[dim], dim, strings.Join(values, ", "))
+			}
+		}
+	}
+
+	return nil
+}
+
+func containsString(l []string, s string) bool {
+	for _, v := range l {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
+
+func customizeDiffMatrix(d *schema.ResourceDiff, meta interface{}) error {
+	return walkSteps(d.Get("step").([]interface{}), "step", func(stepM map[string]interface{}, path string) error {
+		matrixI, ok := stepM["matrix"].([]interface{})
+		if !ok || !d.NewValueKnown(path+".matrix") {
+			return nil
+		}
+		if m := expandMatrix(matrixI); m != nil {
+			if err := validateMatrix(m); err != nil {
+				return fmt.Errorf("%s.matrix: %s", path, err)
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,165 @@
+package buildkite
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMatrix_jsonRoundTrip(t *testing.T) {
+	cases := []string{
+		`["linux","macos"]`,
+		`{"setup":["linux","macos"],"adjustments":[{"skip":"not supported","with":"macos"}]}`,
+		`{"setup":{"os":["linux","windows"],"ruby":["2.7","3.0"]},"adjustments":[{"soft_fail":true,"with":{"os":"windows","ruby":"2.7"}}]}`,
+		`{"setup":["linux","macos"],"adjustments":[{"soft_fail":[{"exit_status":1},{"exit_status":"*"}],"with":"macos"}]}`,
+	}
+
+	for _, tc := range cases {
+		m := &Matrix{}
+		if err := json.Unmarshal([]byte(tc), m); err != nil {
+			t.Fatalf("unmarshal %s: %s", tc, err)
+		}
+		out, err := json.Marshal(m)
+		if err != nil {
+			t.Fatalf("marshal %s: %s", tc, err)
+		}
+		if string(out) != tc {
+			t.Errorf("round trip mismatch:\n got: %s\nwant: %s", out, tc)
+		}
+	}
+}
+
+func TestMatrix_unmarshalNonStringValues(t *testing.T) {
+	m := &Matrix{}
+	if err := json.Unmarshal([]byte(`{"setup":{"node":[12,14.5]},"adjustments":[{"with":{"node":12},"skip":true}]}`), m); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Matrix{
+		Setup: map[string][]string{"node": []string{"12", "14.5"}},
+		Adjustments: []MatrixAdjustment{
+			{With: map[string]string{"node": "12"}, Skip: "true"},
+		},
+	}
+	if !reflect.DeepEqual(m, expected) {
+		t.Errorf("got %#v, want %#v", m, expected)
+	}
+}
+
+func TestValidateMatrix(t *testing.T) {
+	cases := []struct {
+		Name   string
+		Matrix *Matrix
+		Valid  bool
+	}{
+		{
+			Name:   "single dimension",
+			Matrix: &Matrix{Values: []string{"a", "b"}},
+			Valid:  true,
+		},
+		{
+			Name:   "empty",
+			Matrix: &Matrix{},
+			Valid:  false,
+		},
+		{
+			Name: "both shapes",
+			Matrix: &Matrix{
+				Values: []string{"a"},
+				Setup:  map[string][]string{"os": []string{"linux"}},
+			},
+			Valid: false,
+		},
+		{
+			Name: "single dimension adjustment",
+			Matrix: &Matrix{
+				Values:      []string{"a", "b"},
+				Adjustments: []MatrixAdjustment{{Value: "b", SoftFail: true}},
+			},
+			Valid: true,
+		},
+		{
+			Name: "soft fail exit statuses",
+			Matrix: &Matrix{
+				Values:      []string{"a", "b"},
+				Adjustments: []MatrixAdjustment{{Value: "b", SoftFailExitStatuses: []string{"1", "*"}}},
+			},
+			Valid: true,
+		},
+		{
+			Name: "soft fail and soft fail exit statuses",
+			Matrix: &Matrix{
+				Values:      []string{"a", "b"},
+				Adjustments: []MatrixAdjustment{{Value: "b", SoftFail: true, SoftFailExitStatuses: []string{"1"}}},
+			},
+			Valid: false,
+		},
+		{
+			Name: "soft fail with a bad exit status",
+			Matrix: &Matrix{
+				Values:      []string{"a", "b"},
+				Adjustments: []MatrixAdjustment{{Value: "b", SoftFailExitStatuses: []string{"one"}}},
+			},
+			Valid: false,
+		},
+		{
+			Name: "single dimension adjustment with unknown value",
+			Matrix: &Matrix{
+				Values:      []string{"a", "b"},
+				Adjustments: []MatrixAdjustment{{Value: "c", Skip: "true"}},
+			},
+			Valid: false,
+		},
+		{
+			Name: "multi dimension adjustment",
+			Matrix: &Matrix{
+				Setup: map[string][]string{
+					"os":   []string{"linux", "windows"},
+					"ruby": []string{"2.7", "3.0"},
+				},
+				Adjustments: []MatrixAdjustment{
+					{With: map[string]string{"os": "windows", "ruby": "2.7"}, Skip: "true"},
+				},
+			},
+			Valid: true,
+		},
+		{
+			Name: "multi dimension adjustment with unknown dimension",
+			Matrix: &Matrix{
+				Setup: map[string][]string{"os": []string{"linux"}},
+				Adjustments: []MatrixAdjustment{
+					{With: map[string]string{"arch": "arm64"}, Skip: "true"},
+				},
+			},
+			Valid: false,
+		},
+		{
+			Name: "multi dimension adjustment with unknown value",
+			Matrix: &Matrix{
+				Setup: map[string][]string{"os": []string{"linux"}},
+				Adjustments: []MatrixAdjustment{
+					{With: map[string]string{"os": "freebsd"}, Skip: "true"},
+				},
+			},
+			Valid: false,
+		},
+		{
+			Name: "multi dimension adjustment using value",
+			Matrix: &Matrix{
+				Setup:       map[string][]string{"os": []string{"linux"}},
+				Adjustments: []MatrixAdjustment{{Value: "linux"}},
+			},
+			Valid: false,
+		},
+	}
+
+	for _, tc := range cases {
+		err := validateMatrix(tc.Matrix)
+		if tc.Valid && err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.Name, err)
+		}
+		if !tc.Valid && err == nil {
+			t.Errorf("%s: expected an error", tc.Name)
+		}
+	}
+}
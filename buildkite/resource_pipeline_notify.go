@@ -0,0 +1,337 @@
+package buildkite
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func notifySchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeList,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"email": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"basecamp_campfire": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"webhook": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"pagerduty_change_event": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+				},
+				"slack": &schema.Schema{
+					Type:     schema.TypeList,
+					Optional: true,
+					MaxItems: 1,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"channels": &schema.Schema{
+								Type:     schema.TypeList,
+								Required: true,
+								MinItems: 1,
+								Elem: &schema.Schema{
+									Type: schema.TypeString,
+								},
+							},
+							"message": &schema.Schema{
+								Type:     schema.TypeString,
+								Optional: true,
+							},
+						},
+					},
+				},
+				"github_commit_status": &schema.Schema{
+					Type:     schema.TypeList,
+					Optional: true,
+					MaxItems: 1,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"context": &schema.Schema{
+								Type:     schema.TypeString,
+								Required: true,
+							},
+						},
+					},
+				},
+				"github_check": &schema.Schema{
+					Type:     schema.TypeList,
+					Optional: true,
+					MaxItems: 1,
+					Elem: &schema.Resource{
+						Schema: map[string]*schema.Schema{
+							"context": &schema.Schema{
+								Type:     schema.TypeString,
+								Required: true,
+							},
+						},
+					},
+				},
+				"if": &schema.Schema{
+					Type:         schema.TypeString,
+					Optional:     true,
+					ValidateFunc: validateConditional,
+				},
+			},
+		},
+	}
+}
+
+// Notification is a single entry of a pipeline or step notify list. Only
+// one destination is set per notification.
+type Notification struct {
+	Email                string
+	BasecampCampfire     string
+	Webhook              string
+	PagerdutyChangeEvent string
+	Slack                *SlackNotification
+	GithubCommitStatus   *GithubNotification
+	GithubCheck          *GithubNotification
+	If                   string
+}
+
+type SlackNotification struct {
+	Channels []string `json:"channels"`
+	Message  string   `json:"message,omitempty"`
+}
+
+type GithubNotification struct {
+	Context string `json:"context"`
+}
+
+// Destinations which Buildkite only supports on the pipeline, not on steps
+var buildOnlyNotifications = []string{"email", "webhook", "pagerduty_change_event"}
+
+func (n Notification) MarshalJSON() ([]byte, error) {
+	out := map[string]interface{}{}
+
+	if n.Email != "" {
+		out["email"] = n.Email
+	}
+	if n.BasecampCampfire != "" {
+		out["basecamp_campfire"] = n.BasecampCampfire
+	}
+	if n.Webhook != "" {
+		out["webhook"] = n.Webhook
+	}
+	if n.PagerdutyChangeEvent != "" {
+		out["pagerduty_change_event"] = n.PagerdutyChangeEvent
+	}
+	if n.Slack != nil {
+		// A single channel without a custom message uses the short form
+		if len(n.Slack.Channels) == 1 && n.Slack.Message == "" {
+			out["slack"] = n.Slack.Channels[0]
+		} else {
+			out["slack"] = n.Slack
+		}
+	}
+	if n.GithubCommitStatus != nil {
+		out["github_commit_status"] = n.GithubCommitStatus
+	}
+	if n.GithubCheck != nil {
+		out["github_check"] = n.GithubCheck
+	}
+	if n.If != "" {
+		out["if"] = n.If
+	}
+
+	return json.Marshal(out)
+}
+
+func (n *Notification) UnmarshalJSON(data []byte) error {
+	var obj struct {
+		Email                string              `json:"email"`
+		BasecampCampfire     string              `json:"basecamp_campfire"`
+		Webhook              string              `json:"webhook"`
+		PagerdutyChangeEvent string              `json:"pagerduty_change_event"`
+		Slack                json.RawMessage     `json:"slack"`
+		GithubCommitStatus   *GithubNotification `json:"github_commit_status"`
+		GithubCheck          *GithubNotification `json:"github_check"`
+		If                   string              `json:"if"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+
+	n.Email = obj.Email
+	n.BasecampCampfire = obj.BasecampCampfire
+	n.Webhook = obj.Webhook
+	n.PagerdutyChangeEvent = obj.PagerdutyChangeEvent
+	n.GithubCommitStatus = obj.GithubCommitStatus
+	n.GithubCheck = obj.GithubCheck
+	n.If = obj.If
+
+	if len(obj.Slack) == 0 || string(obj.Slack) == "null" {
+		return nil
+	}
+
+	var channel string
+	if err := json.Unmarshal(obj.Slack, &channel); err == nil {
+		n.Slack = &SlackNotification{Channels: []string{channel}}
+		return nil
+	}
+
+	var slack struct {
+		Channel  string   `json:"channel"`
+		Channels []string `json:"channels"`
+		Message  string   `json:"message"`
+	}
+	if err := json.Unmarshal(obj.Slack, &slack); err != nil {
+		return fmt.Errorf("unexpected slack notification %s", string(obj.Slack))
+	}
+	n.Slack = &SlackNotification{Channels: slack.Channels, Message: slack.Message}
+	if slack.Channel != "" {
+		n.Slack.Channels = append([]string{slack.Channel}, n.Slack.Channels...)
+	}
+	return nil
+}
+
+// destinations returns the names of the notification targets which are set.
+func (n Notification) destinations() []string {
+	set := map[string]bool{
+		"email":                  n.Email != "",
+		"basecamp_campfire":      n.BasecampCampfire != "",
+		"webhook":                n.Webhook != "",
+		"pagerduty_change_event": n.PagerdutyChangeEvent != "",
+		"slack":                  n.Slack != nil,
+		"github_commit_status":   n.GithubCommitStatus != nil,
+		"github_check":           n.GithubCheck != nil,
+	}
+
+	names := []string{}
+	for k, v := range set {
+		if v {
+			names = append(names, k)
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+func expandNotifications(notifyI []interface{}) []Notification {
+	if len(notifyI) == 0 {
+		return nil
+	}
+
+	notifications := make([]Notification, 0, len(notifyI))
+	for _, nI := range notifyI {
+		nM, ok := nI.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		n := Notification{
+			Email:                nM["email"].(string),
+			BasecampCampfire:     nM["basecamp_campfire"].(string),
+			Webhook:              nM["webhook"].(string),
+			PagerdutyChangeEvent: nM["pagerduty_change_event"].(string),
+			If:                   nM["if"].(string),
+		}
+
+		if slackI := nM["slack"].([]interface{}); len(slackI) > 0 && slackI[0] != nil {
+			slackM := slackI[0].(map[string]interface{})
+			n.Slack = &SlackNotification{Message: slackM["message"].(string)}
+			for _, vI := range slackM["channels"].([]interface{}) {
+				n.Slack.Channels = append(n.Slack.Channels, vI.(string))
+			}
+		}
+		if ghI := nM["github_commit_status"].([]interface{}); len(ghI) > 0 && ghI[0] != nil {
+			n.GithubCommitStatus = &GithubNotification{
+				Context: ghI[0].(map[string]interface{})["context"].(string),
+			}
+		}
+		if ghI := nM["github_check"].([]interface{}); len(ghI) > 0 && ghI[0] != nil {
+			n.GithubCheck = &GithubNotification{
+				Context: ghI[0].(map[string]interface{})["context"].(string),
+			}
+		}
+
+		notifications = append(notifications, n)
+	}
+	return notifications
+}
+
+func flattenNotifications(notifications []Notification) []interface{} {
+	notifyI := make([]interface{}, len(notifications))
+
+	for i, n := range notifications {
+		nM := map[string]interface{}{
+			"email":                  n.Email,
+			"basecamp_campfire":      n.BasecampCampfire,
+			"webhook":                n.Webhook,
+			"pagerduty_change_event": n.PagerdutyChangeEvent,
+			"if":                     n.If,
+			"slack":                  []interface{}{},
+			"github_commit_status":   []interface{}{},
+			"github_check":           []interface{}{},
+		}
+		if n.Slack != nil {
+			nM["slack"] = []interface{}{
+				map[string]interface{}{
+					"channels": n.Slack.Channels,
+					"message":  n.Slack.Message,
+				},
+			}
+		}
+		if n.GithubCommitStatus != nil {
+			nM["github_commit_status"] = []interface{}{
+				map[string]interface{}{"context": n.GithubCommitStatus.Context},
+			}
+		}
+		if n.GithubCheck != nil {
+			nM["github_check"] = []interface{}{
+				map[string]interface{}{"context": n.GithubCheck.Context},
+			}
+		}
+		notifyI[i] = nM
+	}
+
+	return notifyI
+}
+
+// validateNotifications checks that each notification has exactly one
+// destination, and that steps only use destinations supported on steps.
+func validateNotifications(notifications []Notification, step bool) error {
+	for i, n := range notifications {
+		dests := n.destinations()
+		if len(dests) == 0 {
+			return fmt.Errorf("notify.%d: one destination must be set", i)
+		}
+		if len(dests) > 1 {
+			return fmt.Errorf("notify.%d: only one destination may be set per notify block, got %s", i, strings.Join(dests, ", "))
+		}
+		if step && containsString(buildOnlyNotifications, dests[0]) {
+			return fmt.Errorf("notify.%d: %s notifications are only supported on the pipeline, not on steps", i, dests[0])
+		}
+	}
+	return nil
+}
+
+func customizeDiffNotify(d *schema.ResourceDiff, meta interface{}) error {
+	if d.NewValueKnown("notify") {
+		if err := validateNotifications(expandNotifications(d.Get("notify").([]interface{})), false); err != nil {
+			return err
+		}
+	}
+
+	return walkSteps(d.Get("step").([]interface{}), "step", func(stepM map[string]interface{}, path string) error {
+		notifyI, ok := stepM["notify"].([]interface{})
+		if !ok || !d.NewValueKnown(path+".notify") {
+			return nil
+		}
+		if err := validateNotifications(expandNotifications(notifyI), true); err != nil {
+			return fmt.Errorf("%s.%s", path, err)
+		}
+		return nil
+	})
+}
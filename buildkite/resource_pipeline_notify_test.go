@@ -0,0 +1,96 @@
+package buildkite
+
+import (
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestNotification_jsonRoundTrip(t *testing.T) {
+	cases := []string{
+		`{"email":"dev@example.com"}`,
+		`{"if":"build.state == \"failed\"","slack":"#builds"}`,
+		`{"slack":{"channels":["#builds","#deploys"],"message":"Deployed"}}`,
+		`{"webhook":"https://example.com/hook"}`,
+		`{"pagerduty_change_event":"abc123"}`,
+		`{"basecamp_campfire":"https://3.basecamp.com/1/integrations/2/buckets/3/chats/4/lines"}`,
+		`{"github_commit_status":{"context":"buildkite/lint"}}`,
+		`{"github_check":{"context":"buildkite/test"}}`,
+	}
+
+	for _, tc := range cases {
+		n := &Notification{}
+		if err := json.Unmarshal([]byte(tc), n); err != nil {
+			t.Fatalf("unmarshal %s: %s", tc, err)
+		}
+		out, err := json.Marshal(n)
+		if err != nil {
+			t.Fatalf("marshal %s: %s", tc, err)
+		}
+		if string(out) != tc {
+			t.Errorf("round trip mismatch:\n got: %s\nwant: %s", out, tc)
+		}
+	}
+}
+
+func TestNotification_unmarshalSlackChannel(t *testing.T) {
+	n := &Notification{}
+	if err := json.Unmarshal([]byte(`{"slack":{"channel":"#builds","message":"hi"}}`), n); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &SlackNotification{Channels: []string{"#builds"}, Message: "hi"}
+	if !reflect.DeepEqual(n.Slack, expected) {
+		t.Errorf("got %#v, want %#v", n.Slack, expected)
+	}
+}
+
+func TestValidateNotifications(t *testing.T) {
+	cases := []struct {
+		Name          string
+		Notifications []Notification
+		Step          bool
+		Valid         bool
+	}{
+		{
+			Name:          "pipeline email",
+			Notifications: []Notification{{Email: "dev@example.com"}},
+			Valid:         true,
+		},
+		{
+			Name:          "step email",
+			Notifications: []Notification{{Email: "dev@example.com"}},
+			Step:          true,
+			Valid:         false,
+		},
+		{
+			Name:          "step slack",
+			Notifications: []Notification{{Slack: &SlackNotification{Channels: []string{"#builds"}}}},
+			Step:          true,
+			Valid:         true,
+		},
+		{
+			Name:          "no destination",
+			Notifications: []Notification{{If: "build.state == \"failed\""}},
+			Valid:         false,
+		},
+		{
+			Name: "several destinations",
+			Notifications: []Notification{{
+				Email:   "dev@example.com",
+				Webhook: "https://example.com/hook",
+			}},
+			Valid: false,
+		},
+	}
+
+	for _, tc := range cases {
+		err := validateNotifications(tc.Notifications, tc.Step)
+		if tc.Valid && err != nil {
+			t.Errorf("%s: unexpected error: %s", tc.Name, err)
+		}
+		if !tc.Valid && err == nil {
+			t.Errorf("%s: expected an error", tc.Name)
+		}
+	}
+}
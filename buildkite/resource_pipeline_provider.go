@@ -0,0 +1,651 @@
+package buildkite
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/url"
+	"reflect"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
+)
+
+// repositoryProvider is the provider block the API returns for a pipeline.
+// Settings are decoded into the type of the provider, anything the API adds
+// later is logged and skipped rather than breaking reads.
+type repositoryProvider struct {
+	RepositoryProviderId string
+	WebhookURL           string
+	GitHub               *GitHubSettings
+	GitHubEnterprise     *GitHubSettings
+	Bitbucket            *BitbucketSettings
+	BitbucketServer      *BitbucketServerSettings
+	GitLab               *GitLabSettings
+}
+
+// providerSettingsBlocks lists the settings blocks along with the provider
+// ids they apply to. Only one of them can be set on a pipeline.
+var providerSettingsBlocks = []struct {
+	Attr      string
+	Providers []string
+	Resource  func() *schema.Resource
+}{
+	{"github_settings", []string{"github"}, githubSettingsResource},
+	{"github_enterprise_settings", []string{"github_enterprise"}, githubSettingsResource},
+	{"bitbucket_settings", []string{"bitbucket"}, bitbucketSettingsResource},
+	{"bitbucket_server_settings", []string{"bitbucket_server"}, bitbucketServerSettingsResource},
+	{"gitlab_settings", []string{"gitlab", "gitlab_ee"}, gitlabSettingsResource},
+}
+
+// GitHubSettings mirrors the github_settings and github_enterprise_settings
+// blocks. The json tags must match the attribute names, as settings are
+// flattened into attributes by their json names.
+type GitHubSettings struct {
+	TriggerMode                             string `json:"trigger_mode"`
+	BuildPullRequests                       bool   `json:"build_pull_requests"`
+	BuildPullRequestReadyForReview          bool   `json:"build_pull_request_ready_for_review"`
+	CancelDeletedBranchBuilds               bool   `json:"cancel_deleted_branch_builds"`
+	PullRequestBranchFilterEnabled          bool   `json:"pull_request_branch_filter_enabled"`
+	PullRequestBranchFilterConfiguration    string `json:"pull_request_branch_filter_configuration"`
+	SkipBuildsForExistingCommits            bool   `json:"skip_builds_for_existing_commits"`
+	SkipPullRequestBuildsForExistingCommits bool   `json:"skip_pull_request_builds_for_existing_commits"`
+	BuildPullRequestForks                   bool   `json:"build_pull_request_forks"`
+	BuildPullRequestLabelsChanged           bool   `json:"build_pull_request_labels_changed"`
+	BuildPullRequestBaseBranchChanged       bool   `json:"build_pull_request_base_branch_changed"`
+	CancelWhenPRClosed                      bool   `json:"cancel_when_pr_closed"`
+	IgnoreDefaultBranchPullRequests         bool   `json:"ignore_default_branch_pull_requests"`
+	FilterEnabled                           bool   `json:"filter_enabled"`
+	FilterCondition                         string `json:"filter_condition"`
+	UseStepKeyAsCommitStatus                bool   `json:"use_step_key_as_commit_status"`
+	PrefixPullRequestForkBranchNames        bool   `json:"prefix_pull_request_fork_branch_names"`
+	BuildBranches                           bool   `json:"build_branches"`
+	BuildTags                               bool   `json:"build_tags"`
+	PublishCommitStatus                     bool   `json:"publish_commit_status"`
+	PublishCommitStatusPerStep              bool   `json:"publish_commit_status_per_step"`
+	PublishBlockedAsPending                 bool   `json:"publish_blocked_as_pending"`
+	SeparatePullRequestStatuses             bool   `json:"separate_pull_request_statuses"`
+	CommitStatus404s                        int    `json:"commit_status_404s"`
+}
+
+// BitbucketSettings mirrors the bitbucket_settings block.
+type BitbucketSettings struct {
+	BuildPullRequests                       bool   `json:"build_pull_requests"`
+	PullRequestBranchFilterEnabled          bool   `json:"pull_request_branch_filter_enabled"`
+	PullRequestBranchFilterConfiguration    string `json:"pull_request_branch_filter_configuration"`
+	BuildBranches                           bool   `json:"build_branches"`
+	CancelDeletedBranchBuilds               bool   `json:"cancel_deleted_branch_builds"`
+	FilterEnabled                           bool   `json:"filter_enabled"`
+	FilterCondition                         string `json:"filter_condition"`
+	SkipPullRequestBuildsForExistingCommits bool   `json:"skip_pull_request_builds_for_existing_commits"`
+	BuildTags                               bool   `json:"build_tags"`
+	PublishCommitStatus                     bool   `json:"publish_commit_status"`
+	PublishCommitStatusPerStep              bool   `json:"publish_commit_status_per_step"`
+	UpgradedToV2Hooks                       bool   `json:"upgraded_to_v2_hooks"`
+}
+
+// BitbucketServerSettings mirrors the bitbucket_server_settings block.
+type BitbucketServerSettings struct {
+	BuildPullRequests                       bool   `json:"build_pull_requests"`
+	PullRequestBranchFilterEnabled          bool   `json:"pull_request_branch_filter_enabled"`
+	PullRequestBranchFilterConfiguration    string `json:"pull_request_branch_filter_configuration"`
+	SkipPullRequestBuildsForExistingCommits bool   `json:"skip_pull_request_builds_for_existing_commits"`
+	BuildBranches                           bool   `json:"build_branches"`
+	BuildTags                               bool   `json:"build_tags"`
+	CancelDeletedBranchBuilds               bool   `json:"cancel_deleted_branch_builds"`
+	FilterEnabled                           bool   `json:"filter_enabled"`
+	FilterCondition                         string `json:"filter_condition"`
+}
+
+// GitLabSettings mirrors the gitlab_settings block. Merge requests are
+// pull requests as far as the API is concerned.
+type GitLabSettings struct {
+	BuildPullRequests                       bool   `json:"build_pull_requests"`
+	PullRequestBranchFilterEnabled          bool   `json:"pull_request_branch_filter_enabled"`
+	PullRequestBranchFilterConfiguration    string `json:"pull_request_branch_filter_configuration"`
+	SkipPullRequestBuildsForExistingCommits bool   `json:"skip_pull_request_builds_for_existing_commits"`
+	BuildBranches                           bool   `json:"build_branches"`
+	BuildTags                               bool   `json:"build_tags"`
+	CancelDeletedBranchBuilds               bool   `json:"cancel_deleted_branch_builds"`
+	FilterEnabled                           bool   `json:"filter_enabled"`
+	FilterCondition                         string `json:"filter_condition"`
+}
+
+// Settings the API returns which describe the repository rather than how
+// it builds, and have no attribute.
+var providerSettingsExcluded = [...]string{"repository", "account"}
+
+func (p *repositoryProvider) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		ID         string                     `json:"id"`
+		WebhookURL string                     `json:"webhook_url"`
+		Settings   map[string]json.RawMessage `json:"settings"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	p.RepositoryProviderId = raw.ID
+	p.WebhookURL = raw.WebhookURL
+
+	switch raw.ID {
+	case "github":
+		p.GitHub = &GitHubSettings{}
+		decodeProviderSettings(raw.ID, raw.Settings, p.GitHub)
+	case "github_enterprise":
+		p.GitHubEnterprise = &GitHubSettings{}
+		decodeProviderSettings(raw.ID, raw.Settings, p.GitHubEnterprise)
+	case "bitbucket":
+		p.Bitbucket = &BitbucketSettings{}
+		decodeProviderSettings(raw.ID, raw.Settings, p.Bitbucket)
+	case "bitbucket_server":
+		p.BitbucketServer = &BitbucketServerSettings{}
+		decodeProviderSettings(raw.ID, raw.Settings, p.BitbucketServer)
+	case "gitlab", "gitlab_ee":
+		p.GitLab = &GitLabSettings{}
+		decodeProviderSettings(raw.ID, raw.Settings, p.GitLab)
+	}
+	return nil
+}
+
+// settings returns the settings block for the provider and its settings, or
+// an empty attribute for providers without settings.
+func (p *repositoryProvider) settings() (string, interface{}) {
+	switch {
+	case p.GitHub != nil:
+		return "github_settings", p.GitHub
+	case p.GitHubEnterprise != nil:
+		return "github_enterprise_settings", p.GitHubEnterprise
+	case p.Bitbucket != nil:
+		return "bitbucket_settings", p.Bitbucket
+	case p.BitbucketServer != nil:
+		return "bitbucket_server_settings", p.BitbucketServer
+	case p.GitLab != nil:
+		return "gitlab_settings", p.GitLab
+	}
+	return "", nil
+}
+
+// decodeProviderSettings reads each known setting on its own, so a setting
+// with an unexpected type only loses that setting.
+func decodeProviderSettings(provider string, raw map[string]json.RawMessage, v interface{}) {
+	known := map[string]bool{}
+	for _, k := range providerSettingsExcluded {
+		known[k] = true
+	}
+
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		name := strings.Split(rt.Field(i).Tag.Get("json"), ",")[0]
+		known[name] = true
+
+		value, ok := raw[name]
+		if !ok {
+			continue
+		}
+		if err := json.Unmarshal(value, rv.Field(i).Addr().Interface()); err != nil {
+			log.Printf("[WARN] buildkite: Ignoring %s setting %q: %s", provider, name, err)
+		}
+	}
+
+	for name := range raw {
+		if !known[name] {
+			log.Printf("[DEBUG] buildkite: Ignoring unknown %s setting %q", provider, name)
+		}
+	}
+}
+
+// flattenProviderSettings turns typed settings into the single element of a
+// settings block.
+func flattenProviderSettings(v interface{}) []interface{} {
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+
+	m := make(map[string]interface{}, rt.NumField())
+	for i := 0; i < rt.NumField(); i++ {
+		name := strings.Split(rt.Field(i).Tag.Get("json"), ",")[0]
+		m[name] = rv.Field(i).Interface()
+	}
+	return []interface{}{m}
+}
+
+// Hosts with a single provider. Anything else is taken to be a self-hosted
+// GitHub Enterprise, Bitbucket Server or GitLab.
+var repositoryHostProviders = map[string]string{
+	"github.com":    "github",
+	"bitbucket.org": "bitbucket",
+	"gitlab.com":    "gitlab",
+}
+
+var selfHostedProviders = []string{"github_enterprise", "bitbucket_server", "gitlab_ee"}
+
+var scpLikeRepository = regexp.MustCompile(`^(?:[^@/]+@)?([^:/]+):`)
+
+// repositoryHost returns the host of a git remote, given as a URL or in the
+// scp-like user@host:path form.
+func repositoryHost(repo string) string {
+	if u, err := url.Parse(repo); err == nil && u.Host != "" {
+		return strings.ToLower(u.Hostname())
+	}
+	if m := scpLikeRepository.FindStringSubmatch(repo); m != nil {
+		return strings.ToLower(m[1])
+	}
+	return ""
+}
+
+// repositoryProviders returns the provider ids the API may detect for a
+// repository, or nil when its host can't be told.
+func repositoryProviders(repo string) []string {
+	host := repositoryHost(repo)
+	if host == "" {
+		return nil
+	}
+	if id, ok := repositoryHostProviders[host]; ok {
+		return []string{id}
+	}
+	return selfHostedProviders
+}
+
+func providersIntersect(a, b []string) bool {
+	for _, x := range a {
+		for _, y := range b {
+			if x == y {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// customizeDiffProviderSettings checks a settings block which is added or
+// changed applies to the provider of the repository.
+func customizeDiffProviderSettings(d *schema.ResourceDiff, meta interface{}) error {
+	if !d.NewValueKnown("repository") {
+		return nil
+	}
+	repo := d.Get("repository").(string)
+	providers := repositoryProviders(repo)
+	if providers == nil {
+		return nil
+	}
+
+	for _, block := range providerSettingsBlocks {
+		if d.Id() != "" && !d.HasChange(block.Attr) {
+			continue
+		}
+		if settings, ok := d.Get(block.Attr).([]interface{}); !ok || len(settings) == 0 {
+			continue
+		}
+		if providersIntersect(block.Providers, providers) {
+			continue
+		}
+
+		var valid []string
+		for _, other := range providerSettingsBlocks {
+			if providersIntersect(other.Providers, providers) {
+				valid = append(valid, other.Attr)
+			}
+		}
+		return fmt.Errorf("%s can't be used with repository %q, use %s instead",
+			block.Attr, repo, strings.Join(valid, " or "))
+	}
+	return nil
+}
+
+// providerSettingsChanged reports whether any of the settings blocks changed.
+func providerSettingsChanged(d *schema.ResourceData) bool {
+	for _, block := range providerSettingsBlocks {
+		if d.HasChange(block.Attr) {
+			return true
+		}
+	}
+	return false
+}
+
+// authoritativeProviderSettings returns every setting of the block in use,
+// leaving out the ones only the API sets. A removed block restores the
+// defaults of its settings.
+func authoritativeProviderSettings(d *schema.ResourceData) map[string]interface{} {
+	for _, block := range providerSettingsBlocks {
+		if blockSettings := d.Get(block.Attr).([]interface{}); len(blockSettings) > 0 {
+			s, _ := blockSettings[0].(map[string]interface{})
+			return providerSettingsWithDefaults(block.Resource(), s)
+		}
+	}
+	for _, block := range providerSettingsBlocks {
+		if old, _ := d.GetChange(block.Attr); len(old.([]interface{})) > 0 {
+			return providerSettingsWithDefaults(block.Resource(), nil)
+		}
+	}
+	return nil
+}
+
+// providerSettingsWithDefaults returns the settings of a block which can be
+// set, with the default of any which are missing.
+func providerSettingsWithDefaults(r *schema.Resource, s map[string]interface{}) map[string]interface{} {
+	settings := map[string]interface{}{}
+	for k, attr := range r.Schema {
+		if !attr.Optional {
+			continue
+		}
+		v, ok := s[k]
+		switch {
+		case ok:
+		case attr.Default != nil:
+			v = attr.Default
+		default:
+			v = attr.Type.Zero()
+		}
+		settings[k] = v
+	}
+	return settings
+}
+
+// providerSettingsSchema returns a settings block, which conflicts with the
+// blocks of every other provider.
+func providerSettingsSchema(attr string, elem *schema.Resource) *schema.Schema {
+	var conflicts []string
+	for _, block := range providerSettingsBlocks {
+		if block.Attr != attr {
+			conflicts = append(conflicts, block.Attr)
+		}
+	}
+	return &schema.Schema{
+		Type:          schema.TypeList,
+		Optional:      true,
+		MaxItems:      1,
+		ConflictsWith: conflicts,
+		Elem:          elem,
+	}
+}
+
+func githubSettingsResource() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"trigger_mode": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validation.StringInSlice(triggerModes, false),
+			},
+			"build_pull_requests": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"build_pull_request_ready_for_review": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"cancel_deleted_branch_builds": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"pull_request_branch_filter_enabled": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"pull_request_branch_filter_configuration": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateBranchFilter,
+			},
+			"skip_builds_for_existing_commits": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"skip_pull_request_builds_for_existing_commits": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"build_pull_request_forks": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"build_pull_request_labels_changed": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"build_pull_request_base_branch_changed": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"cancel_when_pr_closed": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"ignore_default_branch_pull_requests": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"filter_enabled": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"filter_condition": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateConditional,
+			},
+			"use_step_key_as_commit_status": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"prefix_pull_request_fork_branch_names": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"build_branches": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"build_tags": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"publish_commit_status": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"publish_commit_status_per_step": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"publish_blocked_as_pending": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"separate_pull_request_statuses": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+			"commit_status_404s": &schema.Schema{
+				Type:     schema.TypeInt,
+				Computed: true,
+			},
+		},
+	}
+}
+
+func bitbucketSettingsResource() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"build_pull_requests": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"pull_request_branch_filter_enabled": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"pull_request_branch_filter_configuration": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateBranchFilter,
+			},
+			"build_branches": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"cancel_deleted_branch_builds": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"filter_enabled": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"filter_condition": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateConditional,
+			},
+			"skip_pull_request_builds_for_existing_commits": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"build_tags": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"publish_commit_status": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"publish_commit_status_per_step": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"upgraded_to_v2_hooks": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+			},
+		},
+	}
+}
+
+func bitbucketServerSettingsResource() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"build_pull_requests": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"pull_request_branch_filter_enabled": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"pull_request_branch_filter_configuration": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateBranchFilter,
+			},
+			"skip_pull_request_builds_for_existing_commits": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"build_branches": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"build_tags": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"cancel_deleted_branch_builds": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"filter_enabled": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"filter_condition": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateConditional,
+			},
+		},
+	}
+}
+
+func gitlabSettingsResource() *schema.Resource {
+	return &schema.Resource{
+		Schema: map[string]*schema.Schema{
+			"build_pull_requests": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"pull_request_branch_filter_enabled": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"pull_request_branch_filter_configuration": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateBranchFilter,
+			},
+			"skip_pull_request_builds_for_existing_commits": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"build_branches": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  true,
+			},
+			"build_tags": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"cancel_deleted_branch_builds": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"filter_enabled": &schema.Schema{
+				Type:     schema.TypeBool,
+				Optional: true,
+				Default:  false,
+			},
+			"filter_condition": &schema.Schema{
+				Type:         schema.TypeString,
+				Optional:     true,
+				ValidateFunc: validateConditional,
+			},
+		},
+	}
+}
@@ -0,0 +1,329 @@
+package buildkite
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestRepositoryProviderUnmarshal(t *testing.T) {
+	var p Pipeline
+	data := `{
+		"slug": "test",
+		"provider": {
+			"id": "github",
+			"webhook_url": "https://webhook.buildkite.com/deliver/abc",
+			"settings": {
+				"repository": "buildkite/example",
+				"build_pull_requests": true,
+				"trigger_mode": "code",
+				"commit_status_404s": "none",
+				"some_new_setting": true
+			}
+		}
+	}`
+	if err := json.Unmarshal([]byte(data), &p); err != nil {
+		t.Fatal(err)
+	}
+
+	if p.Provider.RepositoryProviderId != "github" || p.Provider.WebhookURL == "" {
+		t.Errorf("unexpected provider %#v", p.Provider)
+	}
+	expected := &GitHubSettings{BuildPullRequests: true, TriggerMode: "code"}
+	if !reflect.DeepEqual(p.Provider.GitHub, expected) {
+		t.Errorf("got %#v, want %#v", p.Provider.GitHub, expected)
+	}
+}
+
+func TestRepositoryProviderUnmarshal_missingFields(t *testing.T) {
+	for _, data := range []string{
+		`{"slug": "test"}`,
+		`{"slug": "test", "provider": null}`,
+		`{"slug": "test", "provider": {}}`,
+		`{"slug": "test", "provider": {"id": "github"}}`,
+		`{"slug": "test", "provider": {"id": "bitbucket", "settings": null}}`,
+	} {
+		var p Pipeline
+		if err := json.Unmarshal([]byte(data), &p); err != nil {
+			t.Errorf("%s: %s", data, err)
+		}
+	}
+}
+
+// The settings types are flattened into the settings blocks field by field,
+// so they need to stay in line with the schema.
+func TestProviderSettingsMatchSchema(t *testing.T) {
+	r := resourcePipeline()
+	for attr, settings := range map[string]interface{}{
+		"github_settings":            &GitHubSettings{},
+		"github_enterprise_settings": &GitHubSettings{},
+		"bitbucket_settings":         &BitbucketSettings{},
+		"bitbucket_server_settings":  &BitbucketServerSettings{},
+		"gitlab_settings":            &GitLabSettings{},
+	} {
+		var fields []string
+		for k := range flattenProviderSettings(settings)[0].(map[string]interface{}) {
+			fields = append(fields, k)
+		}
+		var attrs []string
+		for k := range r.Schema[attr].Elem.(*schema.Resource).Schema {
+			attrs = append(attrs, k)
+		}
+		sort.Strings(fields)
+		sort.Strings(attrs)
+
+		if !reflect.DeepEqual(fields, attrs) {
+			t.Errorf("%s: settings fields %v don't match attributes %v", attr, fields, attrs)
+		}
+	}
+}
+
+// The fixtures in testdata list every setting the API returns for each
+// provider. When the API gains a setting, add it to the fixture along with
+// a field and attribute, or to providerSettingsExcluded.
+func TestProviderSettingsFixtures(t *testing.T) {
+	for file, settings := range map[string]interface{}{
+		"provider_github.json":            &GitHubSettings{},
+		"provider_github_enterprise.json": &GitHubSettings{},
+		"provider_bitbucket.json":         &BitbucketSettings{},
+		"provider_bitbucket_server.json":  &BitbucketServerSettings{},
+		"provider_gitlab.json":            &GitLabSettings{},
+	} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var raw struct {
+			Settings map[string]json.RawMessage `json:"settings"`
+		}
+		if err := json.Unmarshal(data, &raw); err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+
+		fields := flattenProviderSettings(settings)[0].(map[string]interface{})
+		excluded := map[string]bool{}
+		for _, k := range providerSettingsExcluded {
+			excluded[k] = true
+		}
+		for k := range raw.Settings {
+			if _, ok := fields[k]; !ok && !excluded[k] {
+				t.Errorf("%s: setting %q has no field", file, k)
+			}
+		}
+		for k := range fields {
+			if _, ok := raw.Settings[k]; !ok {
+				t.Errorf("%s: field %q is missing from the fixture", file, k)
+			}
+		}
+	}
+}
+
+func TestUpdatePipelineFromAPI_providerSettings(t *testing.T) {
+	for file, attr := range map[string]string{
+		"provider_github.json":            "github_settings",
+		"provider_github_enterprise.json": "github_enterprise_settings",
+		"provider_bitbucket.json":         "bitbucket_settings",
+		"provider_bitbucket_server.json":  "bitbucket_server_settings",
+		"provider_gitlab.json":            "gitlab_settings",
+	} {
+		data, err := ioutil.ReadFile(filepath.Join("testdata", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := &Pipeline{Slug: "test"}
+		if err := json.Unmarshal(data, &p.Provider); err != nil {
+			t.Fatalf("%s: %s", file, err)
+		}
+
+		d := schema.TestResourceDataRaw(t, resourcePipeline().Schema, map[string]interface{}{
+			attr: []interface{}{map[string]interface{}{}},
+		})
+		if err := updatePipelineFromAPI(d, p, nil); err != nil {
+			t.Fatal(err)
+		}
+		if !d.Get(attr + ".0.filter_enabled").(bool) {
+			t.Errorf("%s: expected filter_enabled to be read back", attr)
+		}
+		if d.Get(attr+".0.filter_condition").(string) == "" {
+			t.Errorf("%s: expected filter_condition to be read back", attr)
+		}
+		if !d.Get(attr + ".0.build_branches").(bool) {
+			t.Errorf("%s: expected build_branches to be read back", attr)
+		}
+
+		// A block which isn't in use stays removed
+		d = schema.TestResourceDataRaw(t, resourcePipeline().Schema, map[string]interface{}{})
+		if err := updatePipelineFromAPI(d, p, nil); err != nil {
+			t.Fatal(err)
+		}
+		if settings := d.Get(attr).([]interface{}); len(settings) != 0 {
+			t.Errorf("%s: expected no settings, got %v", attr, settings)
+		}
+	}
+}
+
+func TestUpdatePipelineFromAPI_missingProvider(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourcePipeline().Schema, map[string]interface{}{
+		"step": []interface{}{
+			map[string]interface{}{"type": "script", "command": "make"},
+		},
+		"github_settings": []interface{}{
+			map[string]interface{}{"trigger_mode": "code"},
+		},
+	})
+
+	if err := updatePipelineFromAPI(d, &Pipeline{Slug: "test"}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if mode := d.Get("github_settings.0.trigger_mode").(string); mode != "code" {
+		t.Errorf("expected settings to be kept, got trigger_mode %q", mode)
+	}
+
+	p := &Pipeline{Slug: "test", Provider: &repositoryProvider{
+		RepositoryProviderId: "github",
+		GitHub:               &GitHubSettings{TriggerMode: "deployment"},
+	}}
+	if err := updatePipelineFromAPI(d, p, nil); err != nil {
+		t.Fatal(err)
+	}
+	if mode := d.Get("github_settings.0.trigger_mode").(string); mode != "deployment" {
+		t.Errorf("expected settings from the API, got trigger_mode %q", mode)
+	}
+}
+
+func TestRepositoryProviders(t *testing.T) {
+	for repo, expected := range map[string][]string{
+		"git@github.com:buildkite/example.git":                {"github"},
+		"https://github.com/buildkite/example.git":            {"github"},
+		"git@bitbucket.org:example/example.git":               {"bitbucket"},
+		"ssh://git@gitlab.com/example/example.git":            {"gitlab"},
+		"git@github.example.com:buildkite/example.git":        selfHostedProviders,
+		"ssh://git@bitbucket.example.com:7999/ex/example.git": selfHostedProviders,
+		"https://bitbucket.example.com/scm/ex/example.git":    selfHostedProviders,
+		"/var/repositories/example.git":                       nil,
+	} {
+		if providers := repositoryProviders(repo); !reflect.DeepEqual(providers, expected) {
+			t.Errorf("%s: got %v, want %v", repo, providers, expected)
+		}
+	}
+}
+
+func TestPipeline_providerSettingsMismatch(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config:      testPipelineProviderSettings("git@gitlab.com:example/example.git", "github_settings"),
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(`github_settings can't be used with repository "git@gitlab.com:example/example.git", use gitlab_settings instead`),
+			},
+			resource.TestStep{
+				Config:      testPipelineProviderSettings("git@github.example.com:example/example.git", "bitbucket_settings"),
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile(`use github_enterprise_settings or bitbucket_server_settings or gitlab_settings instead`),
+			},
+			resource.TestStep{
+				Config:             testPipelineProviderSettings("git@github.example.com:example/example.git", "github_enterprise_settings"),
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
+
+func testPipelineProviderSettings(repo, attr string) string {
+	return fmt.Sprintf(`
+provider "buildkite" {
+  organization = "test"
+  api_token    = "test"
+}
+
+resource "buildkite_pipeline" "test" {
+  name       = "test"
+  repository = %q
+
+  %s {
+    build_tags = true
+  }
+
+  step {
+    type    = "script"
+    command = "make"
+  }
+}
+`, repo, attr)
+}
+
+// Removing a settings block only restores the defaults when settings are
+// managed authoritatively, an empty block restores them in either mode.
+func TestPreparePipelineUpdatePayload_authoritativeProviderSettings(t *testing.T) {
+	step := map[string]interface{}{"type": "script", "command": "make"}
+
+	for _, tc := range []struct {
+		mode     string
+		block    []interface{}
+		expected interface{}
+	}{
+		{"changes", nil, nil},
+		{"authoritative", nil, false},
+		{"changes", []interface{}{map[string]interface{}{}}, false},
+		{"authoritative", []interface{}{map[string]interface{}{}}, false},
+	} {
+		name := fmt.Sprintf("%s with %d blocks", tc.mode, len(tc.block))
+		state := testPipelineState(t, map[string]interface{}{
+			"name":                     "test",
+			"repository":               "git@github.com:buildkite/example.git",
+			"manage_provider_settings": tc.mode,
+			"step":                     []interface{}{step},
+			"github_settings": []interface{}{
+				map[string]interface{}{"build_tags": true},
+			},
+		})
+		c := map[string]interface{}{
+			"name":                     "test",
+			"repository":               "git@github.com:buildkite/example.git",
+			"manage_provider_settings": tc.mode,
+			"step":                     []interface{}{step},
+		}
+		if tc.block != nil {
+			c["github_settings"] = tc.block
+		}
+		d, diff := testPipelineUpdate(t, state, c, nil)
+		if !d.HasChange("github_settings") {
+			t.Errorf("%s: expected the settings to change, got %v", name, diff)
+			continue
+		}
+
+		patch := preparePipelineUpdatePayload(d)
+		settings, ok := patch["provider_settings"].(map[string]interface{})
+		if tc.expected == nil {
+			if ok {
+				t.Errorf("%s: expected no settings, got %v", name, settings)
+			}
+			continue
+		}
+		if settings["build_tags"] != tc.expected {
+			t.Errorf("%s: expected build_tags %v, got %v", name, tc.expected, settings["build_tags"])
+		}
+		if tc.mode == "changes" {
+			if len(settings) != 1 {
+				t.Errorf("%s: expected only the changed setting, got %v", name, settings)
+			}
+			continue
+		}
+		if settings["build_pull_requests"] != true || settings["trigger_mode"] != "" {
+			t.Errorf("%s: expected every setting to be sent, got %v", name, settings)
+		}
+		if _, ok := settings["commit_status_404s"]; ok {
+			t.Errorf("%s: computed settings shouldn't be sent, got %v", name, settings)
+		}
+	}
+}
@@ -0,0 +1,279 @@
+package buildkite
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// The values of sensitive_env never reach the state. The state holds an HMAC
+// of each value, keyed on a salt generated for each pipeline, which the
+// configuration is compared against, and values which haven't changed are
+// sent again from the pipeline itself. State from before the salt holds plain
+// SHA-256 hashes until the next read.
+
+var sensitiveHashRegexp = regexp.MustCompile(`^(hmac-)?sha256:[0-9a-f]{64}$`)
+
+// secretEnvRegexp matches the names of variables which look like secrets.
+var secretEnvRegexp = regexp.MustCompile(`(?i)_(TOKEN|PASSWORD|SECRET)$`)
+
+func envSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:         schema.TypeMap,
+		Optional:     true,
+		ValidateFunc: validateEnv,
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	}
+}
+
+func sensitiveEnvSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:             schema.TypeMap,
+		Optional:         true,
+		Sensitive:        true,
+		ValidateFunc:     validateEnvNames,
+		DiffSuppressFunc: suppressSensitiveEnvDiff,
+		Elem: &schema.Schema{
+			Type: schema.TypeString,
+		},
+	}
+}
+
+func hashSensitiveValue(salt, v string) string {
+	if salt == "" {
+		sum := sha256.Sum256([]byte(v))
+		return "sha256:" + hex.EncodeToString(sum[:])
+	}
+	mac := hmac.New(sha256.New, []byte(salt))
+	mac.Write([]byte(v))
+	return "hmac-sha256:" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// sensitiveEnvSalt returns the salt the sensitive values of the pipeline are
+// hashed with, generating one for new pipelines and older state.
+func sensitiveEnvSalt(d *schema.ResourceData) (string, error) {
+	if salt := d.Get("sensitive_env_salt").(string); salt != "" {
+		return salt, nil
+	}
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	salt := hex.EncodeToString(b)
+	d.Set("sensitive_env_salt", salt)
+	return salt, nil
+}
+
+func suppressSensitiveEnvDiff(k, old, new string, d *schema.ResourceData) bool {
+	if strings.HasSuffix(k, ".%") {
+		return false
+	}
+	return old != "" && old == hashSensitiveValue(d.Get("sensitive_env_salt").(string), new)
+}
+
+// validateEnv warns about variables which look like secrets, as env is shown
+// in plans and kept in the state.
+func validateEnv(v interface{}, k string) (ws []string, es []error) {
+	_, es = validateEnvNames(v, k)
+	env, _ := v.(map[string]interface{})
+	names := make([]string, 0, len(env))
+	for name := range env {
+		if secretEnvRegexp.MatchString(name) {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		ws = append(ws, fmt.Sprintf("%s.%s looks like a secret, set it in sensitive_env to keep it out of plans and state", k, name))
+	}
+	return ws, es
+}
+
+// mergeSensitiveEnv adds the sensitive variables to env, which is what the
+// API takes.
+func mergeSensitiveEnv(env map[string]string, sensitiveI interface{}) {
+	sensitive, _ := sensitiveI.(map[string]interface{})
+	for k, vI := range sensitive {
+		env[k] = vI.(string)
+	}
+}
+
+// splitSensitiveEnv separates the variables of the API which were configured
+// as sensitive, by the keys of the prior sensitive_env, and hashes them.
+func splitSensitiveEnv(env map[string]string, priorI interface{}, salt string) (map[string]string, map[string]string) {
+	prior, _ := priorI.(map[string]interface{})
+	plain := map[string]string{}
+	sensitive := map[string]string{}
+	for k, v := range env {
+		if _, ok := prior[k]; ok {
+			sensitive[k] = hashSensitiveValue(salt, v)
+		} else {
+			plain[k] = v
+		}
+	}
+	return plain, sensitive
+}
+
+// addStepSensitiveEnv merges the sensitive variables of each step into its
+// env. It is kept out of expandSteps so they aren't rendered into
+// rendered_configuration.
+func addStepSensitiveEnv(steps []Step, stepsI []interface{}) {
+	for i, stepI := range stepsI {
+		stepM, ok := stepI.(map[string]interface{})
+		if !ok || i >= len(steps) {
+			continue
+		}
+		mergeSensitiveEnv(steps[i].Environment, stepM["sensitive_env"])
+		if nestedI, ok := stepM["step"].([]interface{}); ok {
+			addStepSensitiveEnv(steps[i].Steps, nestedI)
+		}
+	}
+}
+
+func hasSensitiveHashes(env map[string]string, steps []Step) bool {
+	for _, v := range env {
+		if sensitiveHashRegexp.MatchString(v) {
+			return true
+		}
+	}
+	for _, step := range steps {
+		if hasSensitiveHashes(step.Environment, step.Steps) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveSensitiveEnv replaces the hashes of unchanged sensitive variables in
+// an update with their values, which are read from the pipeline.
+func resolveSensitiveEnv(client *Client, slug, salt string, patch map[string]interface{}) error {
+	env, _ := patch["env"].(map[string]string)
+	steps, _ := patch["steps"].([]Step)
+	if !hasSensitiveHashes(env, steps) {
+		return nil
+	}
+
+	current := &Pipeline{}
+	if err := client.Get([]string{"pipelines", slug}, current); err != nil {
+		return err
+	}
+	if !sensitiveValuesMatch(env, current.Environment, salt) {
+		return fmt.Errorf("sensitive_env was changed outside of Terraform, refresh and plan again")
+	}
+	restoreSensitiveValues(env, current.Environment)
+	return restoreStepSensitiveValues(steps, current.Steps, salt, "step")
+}
+
+// sensitiveValuesMatch reports whether each hash in env is that of the
+// variable in current.
+func sensitiveValuesMatch(env, current map[string]string, salt string) bool {
+	for k, v := range env {
+		if !sensitiveHashRegexp.MatchString(v) {
+			continue
+		}
+		value, ok := current[k]
+		if !ok || hashSensitiveValue(salt, value) != v {
+			return false
+		}
+	}
+	return true
+}
+
+func restoreSensitiveValues(env, current map[string]string) {
+	for k, v := range env {
+		if sensitiveHashRegexp.MatchString(v) {
+			env[k] = current[k]
+		}
+	}
+}
+
+// restoreStepSensitiveValues restores the values of each step from the step
+// of the pipeline it matches, so steps which were added, removed or moved
+// don't take the values of another step.
+func restoreStepSensitiveValues(steps, current []Step, salt, prefix string) error {
+	for i, step := range steps {
+		if !hasSensitiveHashes(step.Environment, step.Steps) {
+			continue
+		}
+		match := findSensitiveStep(step, current, salt)
+		if match == nil {
+			return fmt.Errorf("%s.%d was changed outside of Terraform, refresh and plan again", prefix, i)
+		}
+		restoreSensitiveValues(step.Environment, match.Environment)
+		if err := restoreStepSensitiveValues(step.Steps, match.Steps, salt, fmt.Sprintf("%s.%d.step", prefix, i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findSensitiveStep finds the step of the pipeline with the same key as step,
+// or otherwise the first whose variables match the hashes of step.
+func findSensitiveStep(step Step, current []Step, salt string) *Step {
+	if step.Key != "" {
+		for i := range current {
+			if current[i].Key == step.Key && sensitiveStepMatches(step, current[i], salt) {
+				return &current[i]
+			}
+		}
+	}
+	for i := range current {
+		if sensitiveStepMatches(step, current[i], salt) {
+			return &current[i]
+		}
+	}
+	return nil
+}
+
+func sensitiveStepMatches(step, current Step, salt string) bool {
+	if !sensitiveValuesMatch(step.Environment, current.Environment, salt) {
+		return false
+	}
+	for _, nested := range step.Steps {
+		if hasSensitiveHashes(nested.Environment, nested.Steps) && findSensitiveStep(nested, current.Steps, salt) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// customizeDiffSensitiveEnv rejects variables set in both env and
+// sensitive_env, which the API can't tell apart.
+func customizeDiffSensitiveEnv(d *schema.ResourceDiff, meta interface{}) error {
+	check := func(env, sensitive interface{}, path string) error {
+		envM, _ := env.(map[string]interface{})
+		sensitiveM, _ := sensitive.(map[string]interface{})
+		keys := make([]string, 0, len(sensitiveM))
+		for k := range sensitiveM {
+			if _, ok := envM[k]; ok {
+				keys = append(keys, k)
+			}
+		}
+		if len(keys) == 0 {
+			return nil
+		}
+		sort.Strings(keys)
+		return fmt.Errorf("%s: %s can't be set in both env and sensitive_env", path, strings.Join(keys, ", "))
+	}
+
+	if d.NewValueKnown("env") && d.NewValueKnown("sensitive_env") {
+		if err := check(d.Get("env"), d.Get("sensitive_env"), "sensitive_env"); err != nil {
+			return err
+		}
+	}
+	if !d.NewValueKnown("step") {
+		return nil
+	}
+	return walkSteps(d.Get("step").([]interface{}), "step", func(stepM map[string]interface{}, path string) error {
+		return check(stepM["env"], stepM["sensitive_env"], path+".sensitive_env")
+	})
+}
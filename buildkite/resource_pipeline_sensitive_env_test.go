@@ -0,0 +1,260 @@
+package buildkite
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+// testSensitiveSalt is the salt of the pipelines in the tests, set on the
+// state as it is computed.
+const testSensitiveSalt = "5a1t"
+
+func testSensitivePipelineState(t *testing.T, salt string, attrs map[string]interface{}) *terraform.InstanceState {
+	state := testPipelineState(t, attrs)
+	if salt != "" {
+		state.Attributes["sensitive_env_salt"] = salt
+	}
+	return state
+}
+
+func TestSensitiveEnv_diff(t *testing.T) {
+	step := func(token string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":          "script",
+			"command":       "make",
+			"sensitive_env": map[string]interface{}{"NPM_TOKEN": token},
+		}
+	}
+
+	// State from before the salt holds plain hashes
+	for _, salt := range []string{testSensitiveSalt, ""} {
+		state := testSensitivePipelineState(t, salt, map[string]interface{}{
+			"name":          "test",
+			"repository":    "git@github.com:buildkite/example.git",
+			"sensitive_env": map[string]interface{}{"DEPLOY_PASSWORD": hashSensitiveValue(salt, "hunter2")},
+			"step":          []interface{}{step(hashSensitiveValue(salt, "abc"))},
+		})
+
+		for _, tc := range []struct {
+			password, token string
+			changed         []string
+		}{
+			{"hunter2", "abc", nil},
+			{"hunter3", "abc", []string{"sensitive_env.DEPLOY_PASSWORD"}},
+			{"hunter2", "def", []string{"step.0.sensitive_env.NPM_TOKEN"}},
+		} {
+			_, diff := testPipelineUpdate(t, state, map[string]interface{}{
+				"name":          "test",
+				"repository":    "git@github.com:buildkite/example.git",
+				"sensitive_env": map[string]interface{}{"DEPLOY_PASSWORD": tc.password},
+				"step":          []interface{}{step(tc.token)},
+			}, nil)
+
+			var changed []string
+			if diff != nil {
+				for k, attr := range diff.Attributes {
+					if strings.Contains(k, "sensitive_env.") && attr.Old != attr.New {
+						changed = append(changed, k)
+						if !attr.Sensitive {
+							t.Errorf("%s: expected the change to be sensitive", k)
+						}
+					}
+				}
+			}
+			if !reflect.DeepEqual(changed, tc.changed) {
+				t.Errorf("salt %q, %s %s: got changes %v, want %v", salt, tc.password, tc.token, changed, tc.changed)
+			}
+		}
+	}
+}
+
+func TestHashSensitiveValue(t *testing.T) {
+	hash := hashSensitiveValue(testSensitiveSalt, "hunter2")
+	if !sensitiveHashRegexp.MatchString(hash) || !strings.HasPrefix(hash, "hmac-sha256:") {
+		t.Errorf("unexpected hash %q", hash)
+	}
+	if hash == hashSensitiveValue("other", "hunter2") {
+		t.Error("expected the hash to depend on the salt")
+	}
+	if legacy := hashSensitiveValue("", "hunter2"); !sensitiveHashRegexp.MatchString(legacy) || !strings.HasPrefix(legacy, "sha256:") {
+		t.Errorf("unexpected hash %q without a salt", legacy)
+	}
+}
+
+func TestSensitiveEnv_conflict(t *testing.T) {
+	_, err := testPipelineDiff(t, nil, map[string]interface{}{
+		"name":          "test",
+		"repository":    "git@github.com:buildkite/example.git",
+		"env":           map[string]interface{}{"API_TOKEN": "a"},
+		"sensitive_env": map[string]interface{}{"API_TOKEN": "b"},
+		"step": []interface{}{
+			map[string]interface{}{"type": "script", "command": "make"},
+		},
+	}, nil)
+	expected := "sensitive_env: API_TOKEN can't be set in both env and sensitive_env"
+	if err == nil || !strings.Contains(err.Error(), expected) {
+		t.Errorf("expected error %q, got %v", expected, err)
+	}
+}
+
+func TestValidateEnv(t *testing.T) {
+	ws, es := validateEnv(map[string]interface{}{
+		"GITHUB_TOKEN":   "a",
+		"DB_PASSWORD":    "b",
+		"TOKEN_LOCATION": "c",
+	}, "env")
+	if len(es) > 0 {
+		t.Fatalf("unexpected errors %v", es)
+	}
+	expected := []string{
+		"env.DB_PASSWORD looks like a secret, set it in sensitive_env to keep it out of plans and state",
+		"env.GITHUB_TOKEN looks like a secret, set it in sensitive_env to keep it out of plans and state",
+	}
+	if !reflect.DeepEqual(ws, expected) {
+		t.Errorf("got warnings %v, want %v", ws, expected)
+	}
+}
+
+func TestUpdatePipeline_sensitiveEnv(t *testing.T) {
+	api := newTestAPI(t)
+	defer api.Close()
+	pipeline := `{
+		"slug": "test",
+		"env": {"REGION": "eu", "DEPLOY_PASSWORD": "hunter2"},
+		"steps": [{"type": "script", "command": "make", "env": {"NPM_TOKEN": "abc"}}]
+	}`
+	api.Respond("GET pipelines/test", pipeline)
+	api.Respond("PATCH pipelines/test", pipeline)
+
+	step := func(command, token string) map[string]interface{} {
+		return map[string]interface{}{
+			"type":          "script",
+			"command":       command,
+			"sensitive_env": map[string]interface{}{"NPM_TOKEN": token},
+		}
+	}
+	state := testSensitivePipelineState(t, testSensitiveSalt, map[string]interface{}{
+		"name":          "test",
+		"repository":    "git@github.com:buildkite/example.git",
+		"env":           map[string]interface{}{"REGION": "us"},
+		"sensitive_env": map[string]interface{}{"DEPLOY_PASSWORD": hashSensitiveValue(testSensitiveSalt, "hunter2")},
+		"step":          []interface{}{step("make", hashSensitiveValue(testSensitiveSalt, "abc"))},
+	})
+	d, _ := testPipelineUpdate(t, state, map[string]interface{}{
+		"name":          "test",
+		"repository":    "git@github.com:buildkite/example.git",
+		"env":           map[string]interface{}{"REGION": "eu"},
+		"sensitive_env": map[string]interface{}{"DEPLOY_PASSWORD": "hunter2"},
+		"step":          []interface{}{step("make test", "abc")},
+	}, nil)
+	if err := UpdatePipeline(d, api.client); err != nil {
+		t.Fatal(err)
+	}
+
+	var patch map[string]interface{}
+	if err := json.Unmarshal([]byte(api.bodies["PATCH pipelines/test"]), &patch); err != nil {
+		t.Fatal(err)
+	}
+
+	expectedEnv := map[string]interface{}{"REGION": "eu", "DEPLOY_PASSWORD": "hunter2"}
+	if !reflect.DeepEqual(patch["env"], expectedEnv) {
+		t.Errorf("got env %v, want %v", patch["env"], expectedEnv)
+	}
+	steps, _ := patch["steps"].([]interface{})
+	if len(steps) != 1 || !reflect.DeepEqual(steps[0].(map[string]interface{})["env"], map[string]interface{}{"NPM_TOKEN": "abc"}) {
+		t.Errorf("expected the step token to be sent, got %v", steps)
+	}
+
+	if env := d.Get("env").(map[string]interface{}); !reflect.DeepEqual(env, map[string]interface{}{"REGION": "eu"}) {
+		t.Errorf("got env %v in state", env)
+	}
+	expected := map[string]interface{}{"DEPLOY_PASSWORD": hashSensitiveValue(testSensitiveSalt, "hunter2")}
+	if sensitive := d.Get("sensitive_env").(map[string]interface{}); !reflect.DeepEqual(sensitive, expected) {
+		t.Errorf("got sensitive_env %v in state, want %v", sensitive, expected)
+	}
+	if token := d.Get("step.0.sensitive_env.NPM_TOKEN").(string); token != hashSensitiveValue(testSensitiveSalt, "abc") {
+		t.Errorf("got step token %q in state", token)
+	}
+}
+
+// Steps are matched by key, or by their hashes, so a step which moved keeps
+// its own values.
+func TestResolveSensitiveEnv_movedSteps(t *testing.T) {
+	api := newTestAPI(t)
+	defer api.Close()
+	api.Respond("GET pipelines/test", `{
+		"slug": "test",
+		"steps": [
+			{"type": "script", "key": "lint", "env": {"NPM_TOKEN": "lint"}},
+			{"type": "script", "key": "publish", "env": {"NPM_TOKEN": "publish"}},
+			{"type": "group", "steps": [{"type": "script", "env": {"DEPLOY_PASSWORD": "hunter2"}}]},
+			{"type": "script", "env": {"DEPLOY_PASSWORD": "hunter3"}}
+		]
+	}`)
+
+	hash := func(v string) map[string]string {
+		return map[string]string{"DEPLOY_PASSWORD": hashSensitiveValue(testSensitiveSalt, v)}
+	}
+	steps := []Step{
+		{Type: "script", Environment: hash("hunter3")},
+		{Type: "group", Environment: map[string]string{}, Steps: []Step{{Type: "script", Environment: hash("hunter2")}}},
+		{Type: "script", Key: "publish", Environment: map[string]string{"NPM_TOKEN": hashSensitiveValue(testSensitiveSalt, "publish")}},
+		{Type: "script", Key: "lint", Environment: map[string]string{"NPM_TOKEN": hashSensitiveValue(testSensitiveSalt, "lint")}},
+	}
+	if err := resolveSensitiveEnv(api.client, "test", testSensitiveSalt, map[string]interface{}{"steps": steps}); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{"hunter3", "hunter2", "publish", "lint"}
+	got := []string{
+		steps[0].Environment["DEPLOY_PASSWORD"],
+		steps[1].Steps[0].Environment["DEPLOY_PASSWORD"],
+		steps[2].Environment["NPM_TOKEN"],
+		steps[3].Environment["NPM_TOKEN"],
+	}
+	if !reflect.DeepEqual(got, expected) {
+		t.Errorf("got values %v, want %v", got, expected)
+	}
+
+	// A value changed outside of Terraform has no step to match
+	steps = []Step{{Type: "script", Key: "lint", Environment: map[string]string{"NPM_TOKEN": hashSensitiveValue(testSensitiveSalt, "old")}}}
+	err := resolveSensitiveEnv(api.client, "test", testSensitiveSalt, map[string]interface{}{"steps": steps})
+	expectedErr := "step.0 was changed outside of Terraform, refresh and plan again"
+	if err == nil || err.Error() != expectedErr {
+		t.Errorf("expected error %q, got %v", expectedErr, err)
+	}
+}
+
+// A salt is generated for state from before it, and the values are hashed
+// with it on the next read.
+func TestUpdatePipelineFromAPI_sensitiveEnvSalt(t *testing.T) {
+	state := testSensitivePipelineState(t, "", map[string]interface{}{
+		"name":          "test",
+		"repository":    "git@github.com:buildkite/example.git",
+		"sensitive_env": map[string]interface{}{"DEPLOY_PASSWORD": hashSensitiveValue("", "hunter2")},
+	})
+	d := resourcePipeline().Data(state)
+	p := &Pipeline{Slug: "test", Environment: map[string]string{"DEPLOY_PASSWORD": "hunter2"}}
+	if err := updatePipelineFromAPI(d, p, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	salt := d.Get("sensitive_env_salt").(string)
+	if len(salt) != 64 {
+		t.Fatalf("expected a salt, got %q", salt)
+	}
+	if hash := d.Get("sensitive_env.DEPLOY_PASSWORD").(string); hash != hashSensitiveValue(salt, "hunter2") {
+		t.Errorf("got hash %q", hash)
+	}
+
+	if err := updatePipelineFromAPI(d, p, nil); err != nil {
+		t.Fatal(err)
+	}
+	if d.Get("sensitive_env_salt").(string) != salt {
+		t.Error("expected the salt to be kept")
+	}
+}
@@ -0,0 +1,745 @@
+package buildkite
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
+)
+
+// maxStepInt bounds the integer attributes of a step. The pipeline schema only
+// sets a minimum of 1, the maximum keeps values within a 32 bit integer.
+const maxStepInt = math.MaxInt32
+
+// stepResource returns the schema of a single pipeline step. Group steps may
+// contain nested steps, which share every attribute except further nesting
+// as Buildkite does not allow groups within groups.
+func stepResource(nested bool) *schema.Resource {
+	s := map[string]*schema.Schema{
+		"type": &schema.Schema{
+			Type:         schema.TypeString,
+			Required:     true,
+			ValidateFunc: validation.StringInSlice(stepTypes, false),
+		},
+		"name": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"key": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"depends_on": &schema.Schema{
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"command": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"env":           envSchema(),
+		"sensitive_env": sensitiveEnvSchema(),
+		"timeout_in_minutes": &schema.Schema{
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: validation.IntBetween(1, maxStepInt),
+		},
+		"agent_query_rules": &schema.Schema{
+			Type:             schema.TypeList,
+			Optional:         true,
+			Deprecated:       "Use agents instead",
+			DiffSuppressFunc: suppressEquivalentAgents,
+			Elem: &schema.Schema{
+				Type:         schema.TypeString,
+				ValidateFunc: validateAgentQueryRule,
+			},
+		},
+		// Moving between agent_query_rules and agents doesn't show a diff
+		// when the targeting is the same.
+		"agents": &schema.Schema{
+			Type:             schema.TypeMap,
+			Optional:         true,
+			ValidateFunc:     validateAgents,
+			DiffSuppressFunc: suppressEquivalentAgents,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"artifact_paths": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"branch_configuration": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: validateBranchFilter,
+		},
+		"concurrency": &schema.Schema{
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: validation.IntBetween(1, maxStepInt),
+		},
+		"concurrency_group": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"concurrency_method": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: validation.StringInSlice([]string{"ordered", "eager"}, false),
+		},
+		"parallelism": &schema.Schema{
+			Type:         schema.TypeInt,
+			Optional:     true,
+			ValidateFunc: validation.IntBetween(1, maxStepInt),
+		},
+		"priority": &schema.Schema{
+			Type:     schema.TypeInt,
+			Optional: true,
+		},
+		// "true", "false" or the reason the step is skipped
+		"skip": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"cancel_on_build_failing": &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+		},
+		"if": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: validateConditional,
+		},
+		"continue_on_failure": &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+		},
+		"prompt": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"blocked_state": &schema.Schema{
+			Type:         schema.TypeString,
+			Optional:     true,
+			ValidateFunc: validation.StringInSlice([]string{"passed", "failed", "running"}, false),
+		},
+		"field": &schema.Schema{
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"type": &schema.Schema{
+						Type:         schema.TypeString,
+						Required:     true,
+						ValidateFunc: validation.StringInSlice([]string{blockFieldText, blockFieldSelect}, false),
+					},
+					"key": &schema.Schema{
+						Type:     schema.TypeString,
+						Required: true,
+					},
+					"label": &schema.Schema{
+						Type:     schema.TypeString,
+						Optional: true,
+					},
+					"hint": &schema.Schema{
+						Type:     schema.TypeString,
+						Optional: true,
+					},
+					"required": &schema.Schema{
+						Type:     schema.TypeBool,
+						Optional: true,
+						Default:  true,
+					},
+					"default": &schema.Schema{
+						Type:     schema.TypeString,
+						Optional: true,
+					},
+					"multiple": &schema.Schema{
+						Type:     schema.TypeBool,
+						Optional: true,
+					},
+					"option": &schema.Schema{
+						Type:     schema.TypeList,
+						Optional: true,
+						Elem: &schema.Resource{
+							Schema: map[string]*schema.Schema{
+								"label": &schema.Schema{
+									Type:     schema.TypeString,
+									Required: true,
+								},
+								"value": &schema.Schema{
+									Type:     schema.TypeString,
+									Required: true,
+								},
+							},
+						},
+					},
+				},
+			},
+		},
+		"trigger_project_slug": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"trigger_commit": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"trigger_branch": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"trigger_message": &schema.Schema{
+			Type:     schema.TypeString,
+			Optional: true,
+		},
+		"trigger_async": &schema.Schema{
+			Type:     schema.TypeBool,
+			Optional: true,
+		},
+		"trigger_env": &schema.Schema{
+			Type:         schema.TypeMap,
+			Optional:     true,
+			ValidateFunc: validateEnvNames,
+			Elem: &schema.Schema{
+				Type: schema.TypeString,
+			},
+		},
+		"cache": &schema.Schema{
+			Type:     schema.TypeList,
+			Optional: true,
+			MaxItems: 1,
+			Elem: &schema.Resource{
+				Schema: map[string]*schema.Schema{
+					"paths": &schema.Schema{
+						Type:     schema.TypeList,
+						Required: true,
+						MinItems: 1,
+						Elem: &schema.Schema{
+							Type: schema.TypeString,
+						},
+					},
+					"name": &schema.Schema{
+						Type:     schema.TypeString,
+						Optional: true,
+					},
+					"size": &schema.Schema{
+						Type:     schema.TypeString,
+						Optional: true,
+					},
+				},
+			},
+		},
+		"matrix": matrixSchema(),
+		"notify": notifySchema(),
+		// Fields of the step which have no attribute, as a JSON object. These
+		// are read from the API and sent back unchanged on update.
+		"extra_json": &schema.Schema{
+			Type:             schema.TypeString,
+			Optional:         true,
+			Computed:         true,
+			ValidateFunc:     validateExtraJSON(stepJSONFields),
+			DiffSuppressFunc: suppressEquivalentJSON,
+		},
+	}
+
+	if !nested {
+		s["step"] = &schema.Schema{
+			Type:     schema.TypeList,
+			Optional: true,
+			Elem:     stepResource(true),
+		}
+	}
+
+	return &schema.Resource{Schema: s}
+}
+
+type Step struct {
+	Type                 string            `json:"type"`
+	Name                 string            `json:"name,omitempty"`
+	Group                string            `json:"group,omitempty"`
+	Key                  string            `json:"key,omitempty"`
+	DependsOn            []string          `json:"depends_on,omitempty"`
+	Command              string            `json:"command,omitempty"`
+	Environment          map[string]string `json:"env,omitempty"`
+	TimeoutInMinutes     int               `json:"timeout_in_minutes,omitempty"`
+	AgentQueryRules      []string          `json:"agent_query_rules,omitempty"`
+	Agents               map[string]string `json:"agents,omitempty"`
+	BranchConfiguration  string            `json:"branch_configuration,omitempty"`
+	ArtifactPaths        string            `json:"artifact_paths,omitempty"`
+	Concurrency          int               `json:"concurrency,omitempty"`
+	ConcurrencyGroup     string            `json:"concurrency_group,omitempty"`
+	ConcurrencyMethod    string            `json:"concurrency_method,omitempty"`
+	Parallelism          int               `json:"parallelism,omitempty"`
+	Priority             int               `json:"priority,omitempty"`
+	Skip                 skipValue         `json:"skip,omitempty"`
+	CancelOnBuildFailing bool              `json:"cancel_on_build_failing,omitempty"`
+	If                   string            `json:"if,omitempty"`
+	ContinueOnFailure    bool              `json:"continue_on_failure,omitempty"`
+	Prompt               string            `json:"prompt,omitempty"`
+	BlockedState         string            `json:"blocked_state,omitempty"`
+	Fields               []BlockField      `json:"fields,omitempty"`
+	TriggerProjectSlug   string            `json:"trigger_project_slug,omitempty"`
+	TriggerCommit        string            `json:"trigger_commit,omitempty"`
+	TriggerBranch        string            `json:"trigger_branch,omitempty"`
+	TriggerMessage       string            `json:"trigger_message,omitempty"`
+	TriggerAsync         bool              `json:"trigger_async,omitempty"`
+	TriggerEnv           map[string]string `json:"trigger_env,omitempty"`
+	Cache                *StepCache        `json:"cache,omitempty"`
+	Matrix               *Matrix           `json:"matrix,omitempty"`
+	Notify               []Notification    `json:"notify,omitempty"`
+	Steps                []Step            `json:"steps,omitempty"`
+
+	Extra map[string]json.RawMessage `json:"-"`
+}
+
+const stepTypeGroup = "group"
+
+const (
+	blockFieldText   = "text"
+	blockFieldSelect = "select"
+)
+
+// BlockField is an input field of a block or input step. It is sent in the
+// same shape as in pipeline YAML, where the field type is the key holding
+// its label.
+type BlockField struct {
+	Type     string
+	Key      string
+	Label    string
+	Hint     string
+	Required bool
+	Default  string
+	Multiple bool
+	Options  []BlockFieldOption
+}
+
+type BlockFieldOption struct {
+	Label string `json:"label"`
+	Value string `json:"value"`
+}
+
+func (f BlockField) MarshalJSON() ([]byte, error) {
+	m := map[string]interface{}{
+		f.Type:     f.Label,
+		"key":      f.Key,
+		"required": f.Required,
+	}
+	if f.Hint != "" {
+		m["hint"] = f.Hint
+	}
+	if f.Default != "" {
+		m["default"] = f.Default
+	}
+	if f.Type == blockFieldSelect {
+		m["multiple"] = f.Multiple
+		m["options"] = f.Options
+	}
+	return json.Marshal(m)
+}
+
+func (f *BlockField) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	switch {
+	case raw[blockFieldText] != nil:
+		f.Type = blockFieldText
+	case raw[blockFieldSelect] != nil:
+		f.Type = blockFieldSelect
+	default:
+		return fmt.Errorf("field must be one of %s or %s", blockFieldText, blockFieldSelect)
+	}
+	f.Label = stringifyScalar(raw[f.Type])
+	f.Key = stringifyScalar(raw["key"])
+	f.Hint = stringifyScalar(raw["hint"])
+
+	// Fields are required unless stated otherwise
+	f.Required = true
+	if required, ok := raw["required"].(bool); ok {
+		f.Required = required
+	}
+	f.Multiple, _ = raw["multiple"].(bool)
+
+	// Multiple selects may default to several options
+	switch def := raw["default"].(type) {
+	case []interface{}:
+		f.Default = strings.Join(stringifyList(def), ",")
+	case nil:
+	default:
+		f.Default = stringifyScalar(def)
+	}
+
+	if options, ok := raw["options"].([]interface{}); ok {
+		for _, optionI := range options {
+			optionM, _ := optionI.(map[string]interface{})
+			f.Options = append(f.Options, BlockFieldOption{
+				Label: stringifyScalar(optionM["label"]),
+				Value: stringifyScalar(optionM["value"]),
+			})
+		}
+	}
+	return nil
+}
+
+func expandBlockFields(fieldsI []interface{}) []BlockField {
+	fields := make([]BlockField, 0, len(fieldsI))
+	for _, fieldI := range fieldsI {
+		fieldM := fieldI.(map[string]interface{})
+		f := BlockField{
+			Type:     fieldM["type"].(string),
+			Key:      fieldM["key"].(string),
+			Label:    fieldM["label"].(string),
+			Hint:     fieldM["hint"].(string),
+			Required: fieldM["required"].(bool),
+			Default:  fieldM["default"].(string),
+			Multiple: fieldM["multiple"].(bool),
+		}
+		for _, optionI := range fieldM["option"].([]interface{}) {
+			optionM := optionI.(map[string]interface{})
+			f.Options = append(f.Options, BlockFieldOption{
+				Label: optionM["label"].(string),
+				Value: optionM["value"].(string),
+			})
+		}
+		fields = append(fields, f)
+	}
+	return fields
+}
+
+func flattenBlockFields(fields []BlockField) []interface{} {
+	fieldsI := make([]interface{}, len(fields))
+	for i, f := range fields {
+		optionsI := make([]interface{}, len(f.Options))
+		for j, option := range f.Options {
+			optionsI[j] = map[string]interface{}{
+				"label": option.Label,
+				"value": option.Value,
+			}
+		}
+		fieldsI[i] = map[string]interface{}{
+			"type":     f.Type,
+			"key":      f.Key,
+			"label":    f.Label,
+			"hint":     f.Hint,
+			"required": f.Required,
+			"default":  f.Default,
+			"multiple": f.Multiple,
+			"option":   optionsI,
+		}
+	}
+	return fieldsI
+}
+
+// StepCache is the cache configuration of a step. The API also accepts a
+// single path or a list of paths, which are read into Paths.
+type StepCache struct {
+	Paths []string `json:"paths"`
+	Name  string   `json:"name,omitempty"`
+	Size  string   `json:"size,omitempty"`
+}
+
+func (c *StepCache) UnmarshalJSON(data []byte) error {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+
+	switch t := raw.(type) {
+	case string:
+		c.Paths = []string{t}
+		return nil
+	case []interface{}:
+		c.Paths = stringifyList(t)
+		return nil
+	}
+
+	var obj struct {
+		Paths interface{} `json:"paths"`
+		Name  string      `json:"name"`
+		Size  string      `json:"size"`
+	}
+	if err := json.Unmarshal(data, &obj); err != nil {
+		return err
+	}
+	switch paths := obj.Paths.(type) {
+	case string:
+		c.Paths = []string{paths}
+	case []interface{}:
+		c.Paths = stringifyList(paths)
+	}
+	c.Name = obj.Name
+	c.Size = obj.Size
+	return nil
+}
+
+func expandStepCache(cacheI []interface{}) *StepCache {
+	if len(cacheI) == 0 || cacheI[0] == nil {
+		return nil
+	}
+	cacheM := cacheI[0].(map[string]interface{})
+
+	c := &StepCache{
+		Name: cacheM["name"].(string),
+		Size: cacheM["size"].(string),
+	}
+	for _, vI := range cacheM["paths"].([]interface{}) {
+		c.Paths = append(c.Paths, vI.(string))
+	}
+	return c
+}
+
+func flattenStepCache(c *StepCache) []interface{} {
+	if c == nil {
+		return []interface{}{}
+	}
+	return []interface{}{
+		map[string]interface{}{
+			"paths": c.Paths,
+			"name":  c.Name,
+			"size":  c.Size,
+		},
+	}
+}
+
+func expandSteps(stepsI []interface{}) []Step {
+	steps := make([]Step, len(stepsI))
+
+	for i, stepI := range stepsI {
+		stepM := stepI.(map[string]interface{})
+		steps[i] = Step{
+			Type:                 stepM["type"].(string),
+			Name:                 stepM["name"].(string),
+			Key:                  stepM["key"].(string),
+			DependsOn:            make([]string, len(stepM["depends_on"].([]interface{}))),
+			Command:              stepM["command"].(string),
+			Environment:          map[string]string{},
+			BranchConfiguration:  stepM["branch_configuration"].(string),
+			ArtifactPaths:        stepM["artifact_paths"].(string),
+			Concurrency:          stepM["concurrency"].(int),
+			ConcurrencyGroup:     stepM["concurrency_group"].(string),
+			ConcurrencyMethod:    stepM["concurrency_method"].(string),
+			Parallelism:          stepM["parallelism"].(int),
+			Priority:             stepM["priority"].(int),
+			Skip:                 skipValue(stepM["skip"].(string)),
+			CancelOnBuildFailing: stepM["cancel_on_build_failing"].(bool),
+			If:                   stepM["if"].(string),
+			ContinueOnFailure:    stepM["continue_on_failure"].(bool),
+			Prompt:               stepM["prompt"].(string),
+			BlockedState:         stepM["blocked_state"].(string),
+			Fields:               expandBlockFields(stepM["field"].([]interface{})),
+			TriggerProjectSlug:   stepM["trigger_project_slug"].(string),
+			TriggerCommit:        stepM["trigger_commit"].(string),
+			TriggerBranch:        stepM["trigger_branch"].(string),
+			TriggerMessage:       stepM["trigger_message"].(string),
+			TriggerAsync:         stepM["trigger_async"].(bool),
+			TriggerEnv:           map[string]string{},
+			Cache:                expandStepCache(stepM["cache"].([]interface{})),
+			TimeoutInMinutes:     stepM["timeout_in_minutes"].(int),
+			Matrix:               expandMatrix(stepM["matrix"].([]interface{})),
+			Notify:               expandNotifications(stepM["notify"].([]interface{})),
+			Extra:                expandExtraJSON(stepM["extra_json"].(string)),
+		}
+
+		for j, vI := range stepM["depends_on"].([]interface{}) {
+			steps[i].DependsOn[j] = vI.(string)
+		}
+
+		for k, vI := range stepM["env"].(map[string]interface{}) {
+			steps[i].Environment[k] = vI.(string)
+		}
+
+		for k, vI := range stepM["trigger_env"].(map[string]interface{}) {
+			steps[i].TriggerEnv[k] = vI.(string)
+		}
+
+		// The API takes agent query rules. Only one of them is configured,
+		// the agents map mirrors the rules in the state when they are in use.
+		if rulesI := stepM["agent_query_rules"].([]interface{}); len(rulesI) > 0 {
+			steps[i].AgentQueryRules = make([]string, len(rulesI))
+			for j, vI := range rulesI {
+				steps[i].AgentQueryRules[j] = vI.(string)
+			}
+		} else {
+			agents := map[string]string{}
+			for k, vI := range stepM["agents"].(map[string]interface{}) {
+				agents[k] = vI.(string)
+			}
+			steps[i].AgentQueryRules = formatAgentQueryRules(agents)
+		}
+
+		if steps[i].Type == stepTypeGroup {
+			// The API labels groups with "group" rather than "name"
+			steps[i].Group = steps[i].Name
+			steps[i].Name = ""
+			steps[i].Steps = expandSteps(stepM["step"].([]interface{}))
+		}
+	}
+
+	return steps
+}
+
+// flattenSteps converts API steps into state. The prior state of the steps is
+// used to preserve the representation of equivalent values.
+func flattenSteps(steps []Step, priorI []interface{}, salt string, nested bool) []interface{} {
+	stepsI := make([]interface{}, len(steps))
+
+	for i, element := range steps {
+		priorM := map[string]interface{}{}
+		if i < len(priorI) {
+			if m, ok := priorI[i].(map[string]interface{}); ok {
+				priorM = m
+			}
+		}
+
+		// The state only holds the agents map when the rules aren't in use
+		agents := stepAgents(element)
+		rules := flattenAgentQueryRules(agents, priorM["agent_query_rules"])
+		if len(rules) > 0 {
+			agents = map[string]string{}
+		}
+		env, sensitiveEnv := splitSensitiveEnv(element.Environment, priorM["sensitive_env"], salt)
+
+		name := element.Name
+		if element.Type == stepTypeGroup && element.Group != "" {
+			name = element.Group
+		}
+
+		stepM := map[string]interface{}{
+			"type":                    element.Type,
+			"name":                    name,
+			"key":                     element.Key,
+			"depends_on":              element.DependsOn,
+			"command":                 element.Command,
+			"env":                     env,
+			"sensitive_env":           sensitiveEnv,
+			"agent_query_rules":       rules,
+			"agents":                  agents,
+			"branch_configuration":    element.BranchConfiguration,
+			"artifact_paths":          element.ArtifactPaths,
+			"concurrency":             element.Concurrency,
+			"concurrency_group":       element.ConcurrencyGroup,
+			"concurrency_method":      element.ConcurrencyMethod,
+			"parallelism":             element.Parallelism,
+			"priority":                element.Priority,
+			"skip":                    string(element.Skip),
+			"cancel_on_build_failing": element.CancelOnBuildFailing,
+			"if":                      element.If,
+			"continue_on_failure":     element.ContinueOnFailure,
+			"prompt":                  element.Prompt,
+			"blocked_state":           element.BlockedState,
+			"field":                   flattenBlockFields(element.Fields),
+			"trigger_project_slug":    element.TriggerProjectSlug,
+			"trigger_commit":          element.TriggerCommit,
+			"trigger_branch":          element.TriggerBranch,
+			"trigger_message":         element.TriggerMessage,
+			"trigger_async":           element.TriggerAsync,
+			"trigger_env":             element.TriggerEnv,
+			"cache":                   flattenStepCache(element.Cache),
+			"timeout_in_minutes":      element.TimeoutInMinutes,
+			"matrix":                  flattenMatrix(element.Matrix, priorM["matrix"]),
+			"notify":                  flattenNotifications(element.Notify),
+			"extra_json":              flattenExtraJSON(element.Extra, priorM["extra_json"]),
+		}
+		if !nested {
+			priorNestedI, _ := priorM["step"].([]interface{})
+			stepM["step"] = flattenSteps(element.Steps, priorNestedI, salt, true)
+		}
+
+		stepsI[i] = stepM
+	}
+
+	return stepsI
+}
+
+// walkSteps calls fn for every step in the configuration, including steps
+// nested in groups, along with the attribute path of the step.
+func walkSteps(stepsI []interface{}, prefix string, fn func(stepM map[string]interface{}, path string) error) error {
+	for i, stepI := range stepsI {
+		stepM, ok := stepI.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		path := fmt.Sprintf("%s.%d", prefix, i)
+
+		if err := fn(stepM, path); err != nil {
+			return err
+		}
+
+		if nestedI, ok := stepM["step"].([]interface{}); ok {
+			if err := walkSteps(nestedI, path+".step", fn); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func customizeDiffGroups(d *schema.ResourceDiff, meta interface{}) error {
+	return walkSteps(d.Get("step").([]interface{}), "step", func(stepM map[string]interface{}, path string) error {
+		nestedI, _ := stepM["step"].([]interface{})
+		stepType, _ := stepM["type"].(string)
+
+		if stepType == stepTypeGroup && strings.Contains(path, ".step.") {
+			return fmt.Errorf("%s: group steps cannot be nested in other groups", path)
+		}
+		if stepType == stepTypeGroup && len(nestedI) == 0 {
+			return fmt.Errorf("%s: a group step must contain at least one nested step", path)
+		}
+		if stepType != stepTypeGroup && len(nestedI) > 0 {
+			return fmt.Errorf("%s: only group steps may contain nested steps", path)
+		}
+		return nil
+	})
+}
+
+func customizeDiffConcurrency(d *schema.ResourceDiff, meta interface{}) error {
+	return walkSteps(d.Get("step").([]interface{}), "step", func(stepM map[string]interface{}, path string) error {
+		concurrency, _ := stepM["concurrency"].(int)
+		group, _ := stepM["concurrency_group"].(string)
+		method, _ := stepM["concurrency_method"].(string)
+
+		if !d.NewValueKnown(path+".concurrency") || !d.NewValueKnown(path+".concurrency_group") {
+			return nil
+		}
+		if concurrency > 0 && group == "" {
+			return fmt.Errorf("%s: concurrency_group is required when concurrency is set", path)
+		}
+		if group != "" && concurrency == 0 {
+			return fmt.Errorf("%s: concurrency is required when concurrency_group is set", path)
+		}
+		if d.NewValueKnown(path+".concurrency_method") && method != "" && group == "" {
+			return fmt.Errorf("%s: concurrency_method is only valid with a concurrency_group", path)
+		}
+		return nil
+	})
+}
+
+// customizeDiffTimeouts checks step timeouts against the maximum the pipeline
+// allows, since Buildkite silently caps them otherwise.
+func customizeDiffTimeouts(d *schema.ResourceDiff, meta interface{}) error {
+	maximum := d.Get("maximum_timeout_in_minutes").(int)
+	if maximum == 0 {
+		return nil
+	}
+
+	if def := d.Get("default_timeout_in_minutes").(int); def > maximum {
+		return fmt.Errorf("default_timeout_in_minutes (%d) exceeds maximum_timeout_in_minutes (%d)", def, maximum)
+	}
+
+	return walkSteps(d.Get("step").([]interface{}), "step", func(stepM map[string]interface{}, path string) error {
+		if timeout, _ := stepM["timeout_in_minutes"].(int); timeout > maximum {
+			return fmt.Errorf("%s: timeout_in_minutes (%d) exceeds maximum_timeout_in_minutes (%d)", path, timeout, maximum)
+		}
+		return nil
+	})
+}
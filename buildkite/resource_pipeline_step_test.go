@@ -0,0 +1,183 @@
+package buildkite
+
+import (
+	"encoding/json"
+	"reflect"
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestSteps_groupRoundTrip(t *testing.T) {
+	raw := map[string]interface{}{
+		"name":       "test",
+		"repository": "git@github.com:yougroupteam/terraform-buildkite.git",
+		"step": []interface{}{
+			map[string]interface{}{
+				"type":    "script",
+				"name":    "build",
+				"key":     "build",
+				"command": "make",
+			},
+			map[string]interface{}{
+				"type":       "group",
+				"name":       ":lint-roller: Lint",
+				"key":        "lint",
+				"depends_on": []interface{}{"build"},
+				"step": []interface{}{
+					map[string]interface{}{
+						"type":    "script",
+						"name":    "go vet",
+						"command": "go vet ./...",
+					},
+					map[string]interface{}{
+						"type":    "script",
+						"name":    "gofmt",
+						"command": "gofmt -l .",
+					},
+				},
+			},
+		},
+	}
+	d := schema.TestResourceDataRaw(t, resourcePipeline().Schema, raw)
+
+	req := preparePipelineRequestPayload(d)
+	if req.Steps[1].Group != ":lint-roller: Lint" || req.Steps[1].Name != "" {
+		t.Fatalf("expected group label to be sent as group, got %#v", req.Steps[1])
+	}
+	if len(req.Steps[1].Steps) != 2 {
+		t.Fatalf("expected 2 nested steps, got %d", len(req.Steps[1].Steps))
+	}
+
+	body, err := json.Marshal(req.Steps)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res := &Pipeline{}
+	if err := json.Unmarshal(body, &res.Steps); err != nil {
+		t.Fatal(err)
+	}
+
+	read := schema.TestResourceDataRaw(t, resourcePipeline().Schema, map[string]interface{}{})
+	if err := updatePipelineFromAPI(read, res, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if !reflect.DeepEqual(d.Get("step"), read.Get("step")) {
+		t.Errorf("steps did not round trip:\n got: %#v\nwant: %#v", read.Get("step"), d.Get("step"))
+	}
+}
+
+func TestStepCache_unmarshal(t *testing.T) {
+	cases := map[string]*StepCache{
+		`"node_modules"`:                   &StepCache{Paths: []string{"node_modules"}},
+		`["node_modules", ".bundle"]`:      &StepCache{Paths: []string{"node_modules", ".bundle"}},
+		`{"paths":"vendor","size":"20g"}`:  &StepCache{Paths: []string{"vendor"}, Size: "20g"},
+		`{"paths":["a","b"],"name":"gem"}`: &StepCache{Paths: []string{"a", "b"}, Name: "gem"},
+	}
+
+	for input, expected := range cases {
+		c := &StepCache{}
+		if err := json.Unmarshal([]byte(input), c); err != nil {
+			t.Fatalf("%s: %s", input, err)
+		}
+		if !reflect.DeepEqual(c, expected) {
+			t.Errorf("%s: got %#v, want %#v", input, c, expected)
+		}
+	}
+}
+
+func TestStep_skipJSON(t *testing.T) {
+	cases := map[skipValue]string{
+		"":                 `{"type":"script"}`,
+		"true":             `{"type":"script","skip":true}`,
+		"flaky on windows": `{"type":"script","skip":"flaky on windows"}`,
+	}
+
+	for skip, expected := range cases {
+		out, err := json.Marshal(Step{Type: "script", Skip: skip})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(out) != expected {
+			t.Errorf("%q: got %s, want %s", skip, out, expected)
+		}
+	}
+}
+
+func TestPipeline_concurrencyRequiresGroup(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config:      testPipeline_concurrencyWithoutGroup,
+				PlanOnly:    true,
+				ExpectError: regexp.MustCompile("concurrency_group is required when concurrency is set"),
+			},
+		},
+	})
+}
+
+const testPipeline_concurrencyWithoutGroup = `
+provider "buildkite" {
+  organization = "test"
+  api_token = "test"
+}
+
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-unit-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+
+  step {
+    type = "script"
+    name = "deploy"
+    command = "make deploy"
+    concurrency = 1
+  }
+}
+`
+
+func TestPipeline_concurrencyUnknown(t *testing.T) {
+	resource.UnitTest(t, resource.TestCase{
+		Providers: testAccProviders,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config:             testPipeline_concurrencyUnknown,
+				PlanOnly:           true,
+				ExpectNonEmptyPlan: true,
+			},
+		},
+	})
+}
+
+const testPipeline_concurrencyUnknown = `
+provider "buildkite" {
+  organization = "test"
+  api_token = "test"
+}
+
+resource "buildkite_pipeline" "test_bar" {
+  name = "tf-unit-bar"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+
+  step {
+    type = "script"
+    command = "make"
+  }
+}
+
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-unit-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+
+  step {
+    type = "script"
+    name = "deploy"
+    command = "make deploy"
+    concurrency = "${length(buildkite_pipeline.test_bar.webhook_url) > 0 ? 1 : 2}"
+    concurrency_group = "deploy"
+  }
+}
+`
@@ -0,0 +1,94 @@
+package buildkite
+
+import (
+	"reflect"
+	"regexp"
+	"sort"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+// Pipelines get the default_tags of the provider along with their own tags.
+// tags only holds the tags of the pipeline, tags_all all of them as set on
+// the pipeline.
+
+var colorRegexp = regexp.MustCompile(`^#([0-9a-fA-F]{3}|[0-9a-fA-F]{6})$`)
+
+func tagsSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeSet,
+		Optional: true,
+		Elem:     &schema.Schema{Type: schema.TypeString},
+		Set:      schema.HashString,
+	}
+}
+
+func expandTags(tagsI interface{}) []string {
+	set, ok := tagsI.(*schema.Set)
+	if !ok {
+		return nil
+	}
+	tags := make([]string, 0, set.Len())
+	for _, tagI := range set.List() {
+		tags = append(tags, tagI.(string))
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+// mergeTags returns the tags of both lists, sorted and without duplicates.
+func mergeTags(a, b []string) []string {
+	seen := map[string]bool{}
+	tags := []string{}
+	for _, list := range [][]string{a, b} {
+		for _, tag := range list {
+			if !seen[tag] {
+				seen[tag] = true
+				tags = append(tags, tag)
+			}
+		}
+	}
+	sort.Strings(tags)
+	return tags
+}
+
+func defaultTags(meta interface{}) []string {
+	if client, ok := meta.(*Client); ok {
+		return client.defaultTags
+	}
+	return nil
+}
+
+// pipelineTags returns the tags of the pipeline which aren't default tags,
+// unless they were also set on the pipeline itself.
+func pipelineTags(all, defaults, prior []string) []string {
+	skip := map[string]bool{}
+	for _, tag := range defaults {
+		skip[tag] = true
+	}
+	for _, tag := range prior {
+		skip[tag] = false
+	}
+
+	tags := []string{}
+	for _, tag := range all {
+		if !skip[tag] {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// customizeDiffTags plans tags_all, so default tags which have changed or
+// are missing from the pipeline show up as a change.
+func customizeDiffTags(d *schema.ResourceDiff, meta interface{}) error {
+	if !d.NewValueKnown("tags") {
+		return d.SetNewComputed("tags_all")
+	}
+
+	all := mergeTags(expandTags(d.Get("tags")), defaultTags(meta))
+	if reflect.DeepEqual(all, expandTags(d.Get("tags_all"))) {
+		return nil
+	}
+	return d.SetNew("tags_all", all)
+}
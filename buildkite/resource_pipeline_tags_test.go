@@ -0,0 +1,83 @@
+package buildkite
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+func TestPipelineTags(t *testing.T) {
+	all := []string{"domain:payments", "owner:platform", "tier:1"}
+
+	// owner:platform is a default tag, tier:1 was added outside of Terraform
+	tags := pipelineTags(all, []string{"domain:payments", "owner:platform"}, []string{"domain:payments"})
+	expected := []string{"domain:payments", "tier:1"}
+	if !reflect.DeepEqual(tags, expected) {
+		t.Errorf("got %v, want %v", tags, expected)
+	}
+}
+
+func TestPipelineTags_diff(t *testing.T) {
+	r := resourcePipeline()
+	step := map[string]interface{}{"type": "script", "command": "make"}
+
+	old := schema.TestResourceDataRaw(t, r.Schema, map[string]interface{}{
+		"name":       "test",
+		"repository": "git@github.com:buildkite/example.git",
+		"step":       []interface{}{step},
+		"tags":       []interface{}{"b", "a"},
+	})
+	old.Set("tags_all", []interface{}{"a", "b", "owner:platform"})
+	old.SetId("test")
+	state := old.State()
+
+	for _, tc := range []struct {
+		defaults []string
+		tagsAll  []string
+	}{
+		{[]string{"owner:platform"}, nil},
+		{[]string{"owner:platform", "cost:ci"}, []string{"a", "b", "cost:ci", "owner:platform"}},
+	} {
+		d, diff := testPipelineUpdate(t, state, map[string]interface{}{
+			"name":       "test",
+			"repository": "git@github.com:buildkite/example.git",
+			"step":       []interface{}{step},
+			"tags":       []interface{}{"a", "b"},
+		}, &Client{defaultTags: tc.defaults})
+
+		if tc.tagsAll == nil {
+			for k := range diff.Attributes {
+				if strings.HasPrefix(k, "tags") {
+					t.Errorf("%v: expected no change to tags, got %s", tc.defaults, k)
+				}
+			}
+			continue
+		}
+		if tags := expandTags(d.Get("tags_all")); !reflect.DeepEqual(tags, tc.tagsAll) {
+			t.Errorf("%v: got tags_all %v, want %v", tc.defaults, tags, tc.tagsAll)
+		}
+		if tags, ok := preparePipelineUpdatePayload(d)["tags"]; !ok || !reflect.DeepEqual(tags, tc.tagsAll) {
+			t.Errorf("%v: got tags %v, want %v", tc.defaults, tags, tc.tagsAll)
+		}
+	}
+}
+
+// An imported pipeline has no prior tags_all, so the default tags of the
+// provider are left out of tags by name.
+func TestUpdatePipelineFromAPI_defaultTags(t *testing.T) {
+	d := schema.TestResourceDataRaw(t, resourcePipeline().Schema, map[string]interface{}{})
+	p := &Pipeline{Slug: "test", Tags: []string{"tier:1", "owner:platform"}}
+	if err := updatePipelineFromAPI(d, p, []string{"owner:platform"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if tags := expandTags(d.Get("tags")); !reflect.DeepEqual(tags, []string{"tier:1"}) {
+		t.Errorf("got tags %v, want [tier:1]", tags)
+	}
+	expected := []string{"owner:platform", "tier:1"}
+	if tags := expandTags(d.Get("tags_all")); !reflect.DeepEqual(tags, expected) {
+		t.Errorf("got tags_all %v, want %v", tags, expected)
+	}
+}
@@ -0,0 +1,158 @@
+package buildkite
+
+import (
+	"log"
+	"sort"
+
+	"github.com/hashicorp/terraform/helper/schema"
+	"github.com/hashicorp/terraform/helper/validation"
+)
+
+// Teams are sent as team_uuids when a pipeline is created, as orgs with
+// teams enabled require them, and are otherwise managed through the team
+// pipelines API. Only the teams in the configuration are read back, the API
+// has no way to list the teams of a pipeline.
+
+const defaultTeamAccessLevel = "manage_build_and_read"
+
+type pipelineTeam struct {
+	PipelineID  string `json:"pipeline_id,omitempty"`
+	AccessLevel string `json:"access_level"`
+}
+
+func teamSchema() *schema.Schema {
+	return &schema.Schema{
+		Type:     schema.TypeSet,
+		Optional: true,
+		Elem: &schema.Resource{
+			Schema: map[string]*schema.Schema{
+				"team_uuid": &schema.Schema{
+					Type:     schema.TypeString,
+					Required: true,
+				},
+				"access_level": &schema.Schema{
+					Type:     schema.TypeString,
+					Optional: true,
+					Default:  defaultTeamAccessLevel,
+					ValidateFunc: validation.StringInSlice([]string{
+						"read_only",
+						"build_and_read",
+						"manage_build_and_read",
+					}, false),
+				},
+			},
+		},
+	}
+}
+
+// expandTeams returns the access level of each team.
+func expandTeams(teamsI interface{}) map[string]string {
+	teams := map[string]string{}
+	set, ok := teamsI.(*schema.Set)
+	if !ok {
+		return teams
+	}
+	for _, teamI := range set.List() {
+		team := teamI.(map[string]interface{})
+		teams[team["team_uuid"].(string)] = team["access_level"].(string)
+	}
+	return teams
+}
+
+func flattenTeams(teams map[string]string) []interface{} {
+	uuids := make([]string, 0, len(teams))
+	for uuid := range teams {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+
+	flattened := make([]interface{}, 0, len(teams))
+	for _, uuid := range uuids {
+		flattened = append(flattened, map[string]interface{}{
+			"team_uuid":    uuid,
+			"access_level": teams[uuid],
+		})
+	}
+	return flattened
+}
+
+func teamUUIDs(teams map[string]string) []string {
+	uuids := make([]string, 0, len(teams))
+	for uuid := range teams {
+		uuids = append(uuids, uuid)
+	}
+	sort.Strings(uuids)
+	return uuids
+}
+
+// readPipelineTeams returns the access level of each of the given teams,
+// leaving out the ones which no longer have access.
+func readPipelineTeams(client *Client, pipelineID string, uuids []string) (map[string]string, error) {
+	teams := map[string]string{}
+	for _, uuid := range uuids {
+		res := &pipelineTeam{}
+		err := client.Get([]string{"teams", uuid, "pipelines", pipelineID}, res)
+		if err != nil {
+			if _, ok := err.(*notFound); ok {
+				log.Printf("[WARN] buildkite: Team %s no longer has access to pipeline %s", uuid, pipelineID)
+				continue
+			}
+			return nil, err
+		}
+		teams[uuid] = res.AccessLevel
+	}
+	return teams, nil
+}
+
+// reconcilePipelineTeams adds, updates and removes teams so the pipeline has
+// the desired teams.
+func reconcilePipelineTeams(client *Client, pipelineID string, current, desired map[string]string) error {
+	for _, uuid := range teamUUIDs(current) {
+		if _, ok := desired[uuid]; ok {
+			continue
+		}
+		log.Printf("[INFO] buildkite: Removing team %s from pipeline %s", uuid, pipelineID)
+		err := client.Delete([]string{"teams", uuid, "pipelines", pipelineID})
+		if _, ok := err.(*notFound); err != nil && !ok {
+			return err
+		}
+	}
+
+	for _, uuid := range teamUUIDs(desired) {
+		level := desired[uuid]
+		currentLevel, ok := current[uuid]
+		switch {
+		case !ok:
+			log.Printf("[INFO] buildkite: Adding team %s to pipeline %s", uuid, pipelineID)
+			req := &pipelineTeam{PipelineID: pipelineID, AccessLevel: level}
+			if err := client.Post([]string{"teams", uuid, "pipelines"}, req, nil); err != nil {
+				return err
+			}
+		case currentLevel != level:
+			log.Printf("[INFO] buildkite: Changing access of team %s to pipeline %s to %s", uuid, pipelineID, level)
+			req := &pipelineTeam{AccessLevel: level}
+			if err := client.Patch([]string{"teams", uuid, "pipelines", pipelineID}, req, nil); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// updatePipelineTeams brings the teams of the pipeline in line with the
+// configuration and reads them back.
+func updatePipelineTeams(d *schema.ResourceData, client *Client, pipelineID string, current map[string]string) error {
+	desired := expandTeams(d.Get("team"))
+	if err := reconcilePipelineTeams(client, pipelineID, current, desired); err != nil {
+		return err
+	}
+	return readTeamsIntoState(d, client, pipelineID)
+}
+
+func readTeamsIntoState(d *schema.ResourceData, client *Client, pipelineID string) error {
+	teams, err := readPipelineTeams(client, pipelineID, teamUUIDs(expandTeams(d.Get("team"))))
+	if err != nil {
+		return err
+	}
+	return d.Set("team", flattenTeams(teams))
+}
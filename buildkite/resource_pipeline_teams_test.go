@@ -0,0 +1,76 @@
+package buildkite
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testTeamsAPI answers reads of team access from teams, and accepts any
+// change to it.
+func testTeamsAPI(t *testing.T, teams map[string]string) *testAPI {
+	api := newTestAPI(t)
+	api.Handle("GET teams/*", func(r *http.Request) string {
+		parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/"), "/")
+		level, ok := teams[parts[1]]
+		if !ok || len(parts) != 4 {
+			return ""
+		}
+		return fmt.Sprintf(`{"pipeline_id": %q, "access_level": %q}`, parts[3], level)
+	})
+	api.Respond("POST teams/*", "{}")
+	api.Respond("PATCH teams/*", "{}")
+	api.Respond("DELETE teams/*", "{}")
+	return api
+}
+
+func TestReconcilePipelineTeams(t *testing.T) {
+	api := testTeamsAPI(t, nil)
+	defer api.Close()
+
+	current := map[string]string{
+		"kept":    "read_only",
+		"changed": "read_only",
+		"removed": "build_and_read",
+	}
+	desired := map[string]string{
+		"kept":    "read_only",
+		"changed": "manage_build_and_read",
+		"added":   "build_and_read",
+	}
+	if err := reconcilePipelineTeams(api.client, "pipeline-uuid", current, desired); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []string{
+		"DELETE teams/removed/pipelines/pipeline-uuid",
+		"POST teams/added/pipelines",
+		"PATCH teams/changed/pipelines/pipeline-uuid",
+	}
+	if requests := api.Requests(); !reflect.DeepEqual(requests, expected) {
+		t.Errorf("got requests\n%s\nwant\n%s", strings.Join(requests, "\n"), strings.Join(expected, "\n"))
+	}
+	expectedBodies := map[string]string{
+		"POST teams/added/pipelines":                  `{"pipeline_id":"pipeline-uuid","access_level":"build_and_read"}`,
+		"PATCH teams/changed/pipelines/pipeline-uuid": `{"access_level":"manage_build_and_read"}`,
+	}
+	if !reflect.DeepEqual(api.bodies, expectedBodies) {
+		t.Errorf("got bodies %v, want %v", api.bodies, expectedBodies)
+	}
+}
+
+func TestReadPipelineTeams(t *testing.T) {
+	api := testTeamsAPI(t, map[string]string{"a": "read_only"})
+	defer api.Close()
+
+	teams, err := readPipelineTeams(api.client, "pipeline-uuid", []string{"a", "gone"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := map[string]string{"a": "read_only"}
+	if !reflect.DeepEqual(teams, expected) {
+		t.Errorf("got %v, want %v", teams, expected)
+	}
+}
@@ -1,11 +1,15 @@
 package buildkite
 
 import (
+	"encoding/json"
 	"fmt"
+	"os"
 	"regexp"
 	"testing"
 
+	"github.com/hashicorp/terraform/config"
 	"github.com/hashicorp/terraform/helper/resource"
+	"github.com/hashicorp/terraform/helper/schema"
 	"github.com/hashicorp/terraform/terraform"
 )
 
@@ -193,6 +197,345 @@ func TestAccPipeline_bitbucketSettingsBuildTags(t *testing.T) {
 	})
 }
 
+func TestAccPipeline_stepMatrix(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckBuildkitePipelineDestroy,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: testAccPipeline_stepMatrix,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.#", "2"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.matrix.#", "1"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.matrix.0.values.#", "2"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.matrix.0.setup.#", "2"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.matrix.0.adjustment.#", "1"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.matrix.0.adjustment.0.with.os", "windows"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.matrix.0.adjustment.0.skip", "true"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccPipeline_stepGroup(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckBuildkitePipelineDestroy,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: testAccPipeline_stepGroup,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.#", "2"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.type", "group"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.name", "Lint"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.key", "lint"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.depends_on.0", "build"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.step.#", "2"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.step.1.command", "gofmt -l ."),
+				),
+			},
+		},
+	})
+}
+
+func TestAccPipeline_notify(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckBuildkitePipelineDestroy,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: testAccPipeline_notify,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "notify.#", "2"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "notify.0.email", "dev@example.com"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "notify.1.slack.0.channels.0", "#builds"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "notify.1.if", "build.state == \"failed\""),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.notify.#", "1"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.notify.0.github_commit_status.0.context", "buildkite/test"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccPipeline_stepAgents(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckBuildkitePipelineDestroy,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: testAccPipeline_stepAgents,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.agents.%", "2"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.agents.queue", "deploy-*"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.agents.os", "linux"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.agent_query_rules.0", "queue=test"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.agents.queue", "test"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccPipeline_stepScheduling(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckBuildkitePipelineDestroy,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: testAccPipeline_stepScheduling,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "default_timeout_in_minutes", "30"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "maximum_timeout_in_minutes", "60"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.concurrency", "1"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.concurrency_group", "tf-acc-foo/deploy"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.concurrency_method", "eager"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.priority", "10"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.cancel_on_build_failing", "true"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.timeout_in_minutes", "45"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.skip", "not ready yet"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.cache.0.paths.0", "node_modules"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccPipeline_configuration(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckBuildkitePipelineDestroy,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: testAccPipeline_configuration,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttrSet("buildkite_pipeline.test_foo", "configuration"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.#", "0"),
+				),
+			},
+			resource.TestStep{
+				ResourceName:      "buildkite_pipeline.test_foo",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func TestAccPipeline_stepTypes(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckBuildkitePipelineDestroy,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: testAccPipeline_stepTypes,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckBuildkitePipelineExists("buildkite_pipeline.test_foo"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.1.continue_on_failure", "true"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.2.field.0.option.#", "2"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.3.trigger_project_slug", "tf-acc-deploy"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.3.trigger_env.RELEASE", "1"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccPipeline_stepExtraJSON(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckBuildkitePipelineDestroy,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: testAccPipeline_stepExtraJSON,
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckBuildkitePipelineExists("buildkite_pipeline.test_foo"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "step.0.extra_json", `{"retry":{"automatic":{"limit":2}}}`),
+				),
+			},
+			resource.TestStep{
+				ResourceName:      "buildkite_pipeline.test_foo",
+				ImportState:       true,
+				ImportStateVerify: true,
+			},
+		},
+	})
+}
+
+func TestAccPipeline_clearSettings(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckBuildkitePipelineDestroy,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: testAccPipeline_settings,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "cancel_running_branch_builds", "true"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "description", "settings"),
+				),
+			},
+			resource.TestStep{
+				Config: testAccPipeline_settingsCleared,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "cancel_running_branch_builds", "false"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "description", ""),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "env.%", "0"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccPipeline_githubSettings(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckBuildkitePipelineDestroy,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: testAccPipeline_githubSettings,
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "github_settings.0.filter_enabled", "true"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "github_settings.0.filter_condition", "build.pull_request.draft != true"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "github_settings.0.build_pull_request_base_branch_changed", "true"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "github_settings.0.cancel_when_pr_closed", "true"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "github_settings.0.ignore_default_branch_pull_requests", "true"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccPipeline_teams(t *testing.T) {
+	team := os.Getenv("BUILDKITE_TEAM_UUID")
+	if team == "" {
+		t.Skip("BUILDKITE_TEAM_UUID must be set for team tests")
+	}
+
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckBuildkitePipelineDestroy,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: fmt.Sprintf(testAccPipeline_teams, team, "read_only"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "visibility", "private"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "team.#", "1"),
+				),
+			},
+			resource.TestStep{
+				Config: fmt.Sprintf(testAccPipeline_teams, team, "build_and_read"),
+				Check: resource.ComposeTestCheckFunc(
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "team.#", "1"),
+				),
+			},
+		},
+	})
+}
+
+func TestAccPipeline_rename(t *testing.T) {
+	resource.Test(t, resource.TestCase{
+		PreCheck:     func() { testAccPreCheck(t) },
+		Providers:    testAccProviders,
+		CheckDestroy: testAccCheckBuildkitePipelineDestroy,
+		Steps: []resource.TestStep{
+			resource.TestStep{
+				Config: fmt.Sprintf(testAccPipeline_rename, "tf-acc-rename"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckBuildkitePipelineExists("buildkite_pipeline.test_foo"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "slug", "tf-acc-rename"),
+				),
+			},
+			resource.TestStep{
+				Config: fmt.Sprintf(testAccPipeline_rename, "tf-acc-renamed"),
+				Check: resource.ComposeTestCheckFunc(
+					testAccCheckBuildkitePipelineExists("buildkite_pipeline.test_foo"),
+					resource.TestCheckResourceAttr("buildkite_pipeline.test_foo", "slug", "tf-acc-renamed"),
+				),
+			},
+		},
+	})
+}
+
+// testResourceConfig builds a resource configuration from its attributes.
+func testResourceConfig(t *testing.T, c map[string]interface{}) *terraform.ResourceConfig {
+	raw, err := config.NewRawConfig(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return terraform.NewResourceConfig(raw)
+}
+
+// testPipelineState is the state of an existing pipeline with the attributes.
+func testPipelineState(t *testing.T, attrs map[string]interface{}) *terraform.InstanceState {
+	d := schema.TestResourceDataRaw(t, resourcePipeline().Schema, attrs)
+	d.SetId("test")
+	return d.State()
+}
+
+// testPipelineDiff plans the configuration c against state, which is nil for
+// a new pipeline.
+func testPipelineDiff(t *testing.T, state *terraform.InstanceState, c map[string]interface{}, meta interface{}) (*terraform.InstanceDiff, error) {
+	return resourcePipeline().Diff(state, testResourceConfig(t, c), meta)
+}
+
+// testPipelineUpdate plans the configuration c against state and returns
+// the data an update is given, along with the plan.
+func testPipelineUpdate(t *testing.T, state *terraform.InstanceState, c map[string]interface{}, meta interface{}) (*schema.ResourceData, *terraform.InstanceDiff) {
+	diff, err := testPipelineDiff(t, state, c, meta)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := schema.InternalMap(resourcePipeline().Schema).Data(state, diff)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return d, diff
+}
+
+// Removing attributes must clear them rather than leave the previous values
+// in place, so the update has to send them as false, empty or null.
+func TestPreparePipelineUpdatePayload(t *testing.T) {
+	step := map[string]interface{}{"type": "script", "command": "make"}
+
+	state := testPipelineState(t, map[string]interface{}{
+		"name":                         "test",
+		"repository":                   "git@github.com:buildkite/example.git",
+		"description":                  "old",
+		"cancel_running_branch_builds": true,
+		"default_timeout_in_minutes":   10,
+		"env":                          map[string]interface{}{"A": "1"},
+		"extra_json":                   `{"allow_rebuilds": false, "pipeline_template_uuid": "5c1b"}`,
+		"step":                         []interface{}{step},
+	})
+	d, _ := testPipelineUpdate(t, state, map[string]interface{}{
+		"name":       "test",
+		"repository": "git@github.com:buildkite/example.git",
+		"extra_json": `{"allow_rebuilds": true}`,
+		"step":       []interface{}{step},
+	}, nil)
+
+	data, err := json.Marshal(preparePipelineUpdatePayload(d))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `{"allow_rebuilds":true,"cancel_running_branch_builds":false,"default_timeout_in_minutes":null,"description":"","env":{},"pipeline_template_uuid":null}`
+	if string(data) != expected {
+		t.Errorf("got %s, want %s", data, expected)
+	}
+}
+
 func testAccCheckBuildkitePipelineExists(id string) resource.TestCheckFunc {
 	return func(s *terraform.State) error {
 		client := testAccProvider.Meta().(*Client)
@@ -207,13 +550,13 @@ func testAccCheckBuildkitePipelineExists(id string) resource.TestCheckFunc {
 			return fmt.Errorf("No Pipeline ID is set")
 		}
 
-		err := client.Get([]string{"pipelines", rs.Primary.ID}, res)
+		err := client.Get([]string{"pipelines", rs.Primary.Attributes["slug"]}, res)
 
 		if err != nil {
 			return err
 		}
 
-		if res.Slug != rs.Primary.ID {
+		if res.Id != rs.Primary.ID {
 			return fmt.Errorf("Pipeline not found")
 		}
 
@@ -231,9 +574,9 @@ func testAccCheckBuildkitePipelineDestroy(s *terraform.State) error {
 
 		res := new(Pipeline)
 
-		err := client.Get([]string{"pipelines", rs.Primary.ID}, res)
+		err := client.Get([]string{"pipelines", rs.Primary.Attributes["slug"]}, res)
 		if err == nil {
-			if res.Slug == rs.Primary.ID {
+			if res.Id == rs.Primary.ID {
 				return fmt.Errorf("Pipeline still exists")
 			}
 		}
@@ -253,7 +596,7 @@ func testAccCheckBuildkitePipelineBasicAttributesFactory(repoProvider string) re
 
 	return resource.ComposeTestCheckFunc(
 		testAccCheckBuildkitePipelineExists(pipelineStateId),
-		resource.TestCheckResourceAttr(pipelineStateId, "id", pipelineName),
+		resource.TestMatchResourceAttr(pipelineStateId, "id", uuidRegexp),
 		resource.TestCheckResourceAttr(pipelineStateId, "slug", pipelineName),
 		resource.TestCheckResourceAttr(pipelineStateId, "name", pipelineName),
 		resource.TestCheckResourceAttrSet(pipelineStateId, "repository"),
@@ -278,6 +621,7 @@ func testAccCheckBuildkitePipelineBasicAttributesFactory(repoProvider string) re
 		resource.TestCheckResourceAttr(pipelineStateId, "env.%", "0"),
 		resource.TestCheckResourceAttrSet(pipelineStateId, "builds_url"),
 		resource.TestCheckResourceAttrSet(pipelineStateId, "web_url"),
+		resource.TestCheckResourceAttr(pipelineStateId, "rendered_configuration", "steps:\n  - label: test\n    command: echo 'Hello World'\n"),
 	)
 }
 
@@ -395,3 +739,339 @@ resource "buildkite_pipeline" "test_foo" {
   }
 }
 `
+
+const testAccPipeline_stepMatrix = `
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-acc-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+
+  step {
+    type = "script"
+    name = "test {{matrix}}"
+    command = "echo 'Hello {{matrix}}'"
+
+    matrix {
+      values = ["linux", "macos"]
+    }
+  }
+
+  step {
+    type = "script"
+    name = "test {{matrix.os}} {{matrix.ruby}}"
+    command = "echo 'Hello World'"
+
+    matrix {
+      setup {
+        name = "os"
+        values = ["linux", "windows"]
+      }
+      setup {
+        name = "ruby"
+        values = ["2.7", "3.0"]
+      }
+
+      adjustment {
+        with = {
+          os = "windows"
+          ruby = "2.7"
+        }
+        skip = true
+      }
+    }
+  }
+}
+`
+
+const testAccPipeline_stepGroup = `
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-acc-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+
+  step {
+    type = "script"
+    name = "build"
+    key = "build"
+    command = "make"
+  }
+
+  step {
+    type = "group"
+    name = "Lint"
+    key = "lint"
+    depends_on = ["build"]
+
+    step {
+      type = "script"
+      name = "vet"
+      command = "go vet ./..."
+    }
+
+    step {
+      type = "script"
+      name = "fmt"
+      command = "gofmt -l ."
+    }
+  }
+}
+`
+
+const testAccPipeline_notify = `
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-acc-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+
+  notify {
+    email = "dev@example.com"
+  }
+
+  notify {
+    slack {
+      channels = ["#builds"]
+      message = "Build failed"
+    }
+    if = "build.state == \"failed\""
+  }
+
+  step {
+    type = "script"
+    name = "test"
+    command = "echo 'Hello World'"
+
+    notify {
+      github_commit_status {
+        context = "buildkite/test"
+      }
+    }
+  }
+}
+`
+
+const testAccPipeline_stepAgents = `
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-acc-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+
+  step {
+    type = "script"
+    name = "deploy"
+    command = "echo 'Hello World'"
+
+    agents = {
+      queue = "deploy-*"
+      os = "linux"
+    }
+  }
+
+  step {
+    type = "script"
+    name = "test"
+    command = "echo 'Hello World'"
+    agent_query_rules = ["queue=test"]
+  }
+}
+`
+
+const testAccPipeline_stepScheduling = `
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-acc-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+  default_timeout_in_minutes = 30
+  maximum_timeout_in_minutes = 60
+
+  step {
+    type = "script"
+    name = "deploy"
+    command = "echo 'Hello World'"
+    concurrency = 1
+    concurrency_group = "tf-acc-foo/deploy"
+    concurrency_method = "eager"
+    priority = 10
+    cancel_on_build_failing = true
+    timeout_in_minutes = 45
+  }
+
+  step {
+    type = "script"
+    name = "test"
+    command = "echo 'Hello World'"
+    skip = "not ready yet"
+
+    cache {
+      paths = ["node_modules"]
+    }
+  }
+}
+`
+
+const testAccPipeline_configuration = `
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-acc-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+
+  configuration = <<EOF
+steps:
+  - label: ":llama: Tests"
+    command: echo 'Hello World'
+EOF
+}
+`
+
+const testAccPipeline_stepTypes = `
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-acc-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+
+  step {
+    type = "script"
+    name = "test"
+    command = "echo 'Hello World'"
+    if = "build.branch == pipeline.default_branch"
+  }
+
+  step {
+    type = "waiter"
+    continue_on_failure = true
+  }
+
+  step {
+    type = "manual"
+    name = ":rocket: Release?"
+    prompt = "Ship it?"
+
+    field {
+      type = "select"
+      key = "environment"
+      label = "Environment"
+
+      option {
+        label = "Staging"
+        value = "staging"
+      }
+
+      option {
+        label = "Production"
+        value = "production"
+      }
+    }
+  }
+
+  step {
+    type = "trigger"
+    name = "Deploy"
+    trigger_project_slug = "tf-acc-deploy"
+    trigger_branch = "main"
+    trigger_async = true
+
+    trigger_env = {
+      RELEASE = "1"
+    }
+  }
+}
+`
+
+const testAccPipeline_stepExtraJSON = `
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-acc-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+
+  step {
+    type = "script"
+    name = "test"
+    command = "echo 'Hello World'"
+
+    extra_json = jsonencode({
+      retry = {
+        automatic = { limit = 2 }
+      }
+    })
+  }
+}
+`
+
+const testAccPipeline_settings = `
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-acc-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+  description = "settings"
+  cancel_running_branch_builds = true
+  skip_queued_branch_builds = true
+  default_timeout_in_minutes = 30
+
+  env = {
+    FOO = "bar"
+  }
+
+  step {
+    type = "script"
+    name = "test"
+    command = "echo 'Hello World'"
+  }
+}
+`
+
+const testAccPipeline_settingsCleared = `
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-acc-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+
+  step {
+    type = "script"
+    name = "test"
+    command = "echo 'Hello World'"
+  }
+}
+`
+
+const testAccPipeline_githubSettings = `
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-acc-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+
+  github_settings {
+    build_pull_requests = true
+    build_pull_request_base_branch_changed = true
+    cancel_when_pr_closed = true
+    ignore_default_branch_pull_requests = true
+    filter_enabled = true
+    filter_condition = "build.pull_request.draft != true"
+  }
+
+  step {
+    type = "script"
+    name = "test"
+    command = "echo 'Hello World'"
+  }
+}
+`
+
+const testAccPipeline_teams = `
+resource "buildkite_pipeline" "test_foo" {
+  name = "tf-acc-foo"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+  visibility = "private"
+
+  team {
+    team_uuid = "%s"
+    access_level = "%s"
+  }
+
+  step {
+    type = "script"
+    name = "test"
+    command = "echo 'Hello World'"
+  }
+}
+`
+
+const testAccPipeline_rename = `
+resource "buildkite_pipeline" "test_foo" {
+  name = "%s"
+  repository = "git@github.com:yougroupteam/terraform-provider-buildkite.git"
+
+  step {
+    type = "script"
+    name = "test"
+    command = "echo 'Hello World'"
+  }
+}
+`
@@ -0,0 +1,227 @@
+package buildkite
+
+import (
+	"fmt"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/terraform/helper/schema"
+)
+
+var stepTypes = []string{"script", "waiter", "manual", "input", "trigger", stepTypeGroup}
+
+var triggerModes = []string{"code", "deployment", "fork", "none"}
+
+var envNameRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// reservedEnvNames are set by the agent for every job, so can't be set by a
+// pipeline or step.
+var reservedEnvNames = map[string]bool{
+	"BUILDKITE":                          true,
+	"BUILDKITE_AGENT_ACCESS_TOKEN":       true,
+	"BUILDKITE_AGENT_ID":                 true,
+	"BUILDKITE_AGENT_NAME":               true,
+	"BUILDKITE_BRANCH":                   true,
+	"BUILDKITE_BUILD_CREATOR":            true,
+	"BUILDKITE_BUILD_CREATOR_EMAIL":      true,
+	"BUILDKITE_BUILD_ID":                 true,
+	"BUILDKITE_BUILD_NUMBER":             true,
+	"BUILDKITE_BUILD_URL":                true,
+	"BUILDKITE_COMMAND":                  true,
+	"BUILDKITE_COMMIT":                   true,
+	"BUILDKITE_JOB_ID":                   true,
+	"BUILDKITE_LABEL":                    true,
+	"BUILDKITE_MESSAGE":                  true,
+	"BUILDKITE_ORGANIZATION_SLUG":        true,
+	"BUILDKITE_PARALLEL_JOB":             true,
+	"BUILDKITE_PARALLEL_JOB_COUNT":       true,
+	"BUILDKITE_PIPELINE_ID":              true,
+	"BUILDKITE_PIPELINE_PROVIDER":        true,
+	"BUILDKITE_PIPELINE_SLUG":            true,
+	"BUILDKITE_PULL_REQUEST":             true,
+	"BUILDKITE_PULL_REQUEST_BASE_BRANCH": true,
+	"BUILDKITE_PULL_REQUEST_REPO":        true,
+	"BUILDKITE_REPO":                     true,
+	"BUILDKITE_RETRY_COUNT":              true,
+	"BUILDKITE_SOURCE":                   true,
+	"BUILDKITE_STEP_ID":                  true,
+	"BUILDKITE_STEP_KEY":                 true,
+	"BUILDKITE_TAG":                      true,
+	"BUILDKITE_TIMEOUT":                  true,
+	"BUILDKITE_TRIGGERED_FROM_BUILD_ID":  true,
+}
+
+var repositorySchemes = map[string]bool{"git": true, "http": true, "https": true, "ssh": true}
+
+// validateEnvNames rejects variable names which aren't valid in a shell, or
+// which the agent sets itself.
+func validateEnvNames(v interface{}, k string) ([]string, []error) {
+	env, _ := v.(map[string]interface{})
+	names := make([]string, 0, len(env))
+	for name := range env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var errs []error
+	for _, name := range names {
+		switch {
+		case !envNameRegexp.MatchString(name):
+			errs = append(errs, fmt.Errorf("%s: %q isn't a valid environment variable name", k, name))
+		case reservedEnvNames[name]:
+			errs = append(errs, fmt.Errorf("%s: %s is set by the agent and can't be overridden", k, name))
+		}
+	}
+	return nil, errs
+}
+
+// validateRepository checks the repository is a git remote, as a URL or in
+// the scp-like user@host:path form.
+func validateRepository(v interface{}, k string) ([]string, []error) {
+	repo := v.(string)
+
+	if strings.Contains(repo, "://") {
+		u, err := url.Parse(repo)
+		if err != nil {
+			return nil, []error{fmt.Errorf("%s: %q isn't a valid URL: %s", k, repo, err)}
+		}
+		if !repositorySchemes[u.Scheme] {
+			return nil, []error{fmt.Errorf("%s: %q must use one of the git, http, https or ssh schemes", k, repo)}
+		}
+		if u.Host == "" || strings.Trim(u.Path, "/") == "" {
+			return nil, []error{fmt.Errorf("%s: %q must have a host and a path", k, repo)}
+		}
+		return nil, nil
+	}
+
+	if m := scpLikeRepository.FindStringIndex(repo); m != nil && m[1] < len(repo) {
+		return nil, nil
+	}
+	return nil, []error{fmt.Errorf("%s: %q isn't a git repository, such as git@github.com:org/repo.git or https://github.com/org/repo.git", k, repo)}
+}
+
+// stepTypeAttributes are the step attributes which only apply to some types
+// of step.
+var stepTypeAttributes = []struct {
+	Attrs []string
+	Types []string
+}{
+	{
+		Attrs: []string{"command", "artifact_paths", "parallelism", "concurrency", "timeout_in_minutes", "cache", "matrix"},
+		Types: []string{"script"},
+	},
+	{
+		Attrs: []string{"prompt", "field", "blocked_state"},
+		Types: []string{"manual", "input"},
+	},
+	{
+		Attrs: []string{"trigger_project_slug", "trigger_commit", "trigger_branch", "trigger_message", "trigger_async", "trigger_env"},
+		Types: []string{"trigger"},
+	},
+}
+
+func isSet(v interface{}) bool {
+	switch v := v.(type) {
+	case string:
+		return v != ""
+	case int:
+		return v != 0
+	case bool:
+		return v
+	case []interface{}:
+		return len(v) > 0
+	case map[string]interface{}:
+		return len(v) > 0
+	}
+	return false
+}
+
+// customizeDiffSteps checks the attributes of each step against its type.
+func customizeDiffSteps(d *schema.ResourceDiff, meta interface{}) error {
+	return walkSteps(d.Get("step").([]interface{}), "step", func(stepM map[string]interface{}, path string) error {
+		stepType, _ := stepM["type"].(string)
+		if !d.NewValueKnown(path + ".type") {
+			return nil
+		}
+
+		for _, rule := range stepTypeAttributes {
+			if containsString(rule.Types, stepType) {
+				continue
+			}
+			for _, attr := range rule.Attrs {
+				if isSet(stepM[attr]) {
+					return fmt.Errorf("%s: %s only applies to %s steps, not %s steps", path, attr, strings.Join(rule.Types, " and "), stepType)
+				}
+			}
+		}
+
+		switch stepType {
+		case "script":
+			// A step may run a plugin rather than a command. extra_json is
+			// computed, so is unknown on new steps which leave it out, and
+			// an unknown value is taken as having no plugins.
+			extra := ""
+			if d.NewValueKnown(path + ".extra_json") {
+				extra, _ = stepM["extra_json"].(string)
+			}
+			if d.NewValueKnown(path+".command") && !isSet(stepM["command"]) && !strings.Contains(extra, `"plugins"`) {
+				return fmt.Errorf("%s: a script step requires a command", path)
+			}
+		case "trigger":
+			if d.NewValueKnown(path+".trigger_project_slug") && !isSet(stepM["trigger_project_slug"]) {
+				return fmt.Errorf("%s: a trigger step requires a trigger_project_slug", path)
+			}
+		}
+		return nil
+	})
+}
+
+// filterSetting pairs a filter with the setting which enables it.
+type filterSetting struct {
+	Filter, Enabled string
+}
+
+var pipelineFilters = []filterSetting{
+	{"skip_queued_branch_builds_filter", "skip_queued_branch_builds"},
+	{"cancel_running_branch_builds_filter", "cancel_running_branch_builds"},
+}
+
+var providerSettingsFilters = []filterSetting{
+	{"pull_request_branch_filter_configuration", "pull_request_branch_filter_enabled"},
+	{"filter_condition", "filter_enabled"},
+}
+
+// customizeDiffFilters rejects filters which are set without the setting that
+// enables them, as the API ignores them. The settings blocks are read from
+// the API, so are only checked when they change.
+func customizeDiffFilters(d *schema.ResourceDiff, meta interface{}) error {
+	for _, f := range pipelineFilters {
+		if !d.NewValueKnown(f.Filter) || !d.NewValueKnown(f.Enabled) {
+			continue
+		}
+		if d.Get(f.Filter).(string) != "" && !d.Get(f.Enabled).(bool) {
+			return fmt.Errorf("%s: only applies when %s is enabled", f.Filter, f.Enabled)
+		}
+	}
+
+	for _, block := range providerSettingsBlocks {
+		if !d.HasChange(block.Attr) || !d.NewValueKnown(block.Attr) {
+			continue
+		}
+		settings, _ := d.Get(block.Attr).([]interface{})
+		if len(settings) == 0 {
+			continue
+		}
+		settingsM, _ := settings[0].(map[string]interface{})
+		for _, f := range providerSettingsFilters {
+			filter, _ := settingsM[f.Filter].(string)
+			enabled, ok := settingsM[f.Enabled].(bool)
+			if ok && filter != "" && !enabled {
+				return fmt.Errorf("%s.0.%s: only applies when %s is enabled", block.Attr, f.Filter, f.Enabled)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,273 @@
+package buildkite
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/hashicorp/terraform/terraform"
+)
+
+func TestValidateRepository(t *testing.T) {
+	for _, repo := range []string{
+		"git@github.com:buildkite/example.git",
+		"github.com:buildkite/example.git",
+		"https://github.com/buildkite/example.git",
+		"ssh://git@bitbucket.example.com:7999/ci/example.git",
+		"git://git.example.com/example",
+	} {
+		if _, errs := validateRepository(repo, "repository"); len(errs) > 0 {
+			t.Errorf("%s: unexpected errors %v", repo, errs)
+		}
+	}
+
+	for _, repo := range []string{
+		"buildkite/example",
+		"git@github.com:",
+		"ftp://example.com/example.git",
+		"https://github.com",
+		"https://github.com/",
+	} {
+		if _, errs := validateRepository(repo, "repository"); len(errs) == 0 {
+			t.Errorf("%s: expected an error", repo)
+		}
+	}
+}
+
+func TestValidateEnvNames(t *testing.T) {
+	_, errs := validateEnvNames(map[string]interface{}{
+		"BUILDKITE_BRANCH":          "main",
+		"BUILDKITE_CLEAN_CHECKOUT":  "true",
+		"1PASSWORD_VAULT":           "ci",
+		"DOCKER-COMPOSE_FILE":       "ci.yml",
+		"BUILDKITE_PLUGINS_ENABLED": "false",
+	}, "env")
+
+	expected := []string{
+		`env: "1PASSWORD_VAULT" isn't a valid environment variable name`,
+		"env: BUILDKITE_BRANCH is set by the agent and can't be overridden",
+		`env: "DOCKER-COMPOSE_FILE" isn't a valid environment variable name`,
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("got errors %v, want %v", errs, expected)
+	}
+	for i, err := range errs {
+		if err.Error() != expected[i] {
+			t.Errorf("got error %q, want %q", err, expected[i])
+		}
+	}
+}
+
+func testPipelineConfig(t *testing.T, c map[string]interface{}) *terraform.ResourceConfig {
+	base := map[string]interface{}{
+		"name":       "test",
+		"repository": "git@github.com:buildkite/example.git",
+	}
+	for k, v := range c {
+		base[k] = v
+	}
+	return testResourceConfig(t, base)
+}
+
+func TestResourcePipeline_validate(t *testing.T) {
+	r := resourcePipeline()
+
+	for _, tc := range []struct {
+		config   map[string]interface{}
+		expected string
+	}{
+		{
+			map[string]interface{}{"step": []interface{}{
+				map[string]interface{}{"type": "command", "command": "make"},
+			}},
+			`expected step.0.type to be one of`,
+		},
+		{
+			map[string]interface{}{
+				"step":            []interface{}{map[string]interface{}{"type": "script", "command": "make"}},
+				"github_settings": []interface{}{map[string]interface{}{"trigger_mode": "push"}},
+			},
+			`expected github_settings.0.trigger_mode to be one of`,
+		},
+		{
+			map[string]interface{}{
+				"step":                       []interface{}{map[string]interface{}{"type": "script", "command": "make"}},
+				"default_timeout_in_minutes": -1,
+			},
+			`expected default_timeout_in_minutes to be at least (0)`,
+		},
+		{
+			map[string]interface{}{"step": []interface{}{
+				map[string]interface{}{"type": "script", "command": "make", "parallelism": 0},
+			}},
+			`expected step.0.parallelism to be in the range (1 - 2147483647), got 0`,
+		},
+		{
+			map[string]interface{}{"step": []interface{}{
+				map[string]interface{}{"type": "script", "command": "make", "sensitive_env": map[string]interface{}{"BUILDKITE_COMMIT": "HEAD"}},
+			}},
+			`step.0.sensitive_env: BUILDKITE_COMMIT is set by the agent`,
+		},
+		{
+			map[string]interface{}{
+				"step":                 []interface{}{map[string]interface{}{"type": "script", "command": "make"}},
+				"branch_configuration": "main !",
+			},
+			`branch_configuration: column 6: "!" has nothing after the !`,
+		},
+		{
+			map[string]interface{}{"step": []interface{}{
+				map[string]interface{}{"type": "script", "command": "make", "if": `build.branch == "main" &&`},
+			}},
+			`step.0.if: column 26: expected a value, got the end of the expression`,
+		},
+		{
+			map[string]interface{}{
+				"step":   []interface{}{map[string]interface{}{"type": "script", "command": "make"}},
+				"notify": []interface{}{map[string]interface{}{"email": "ci@example.com", "if": `build.state == failed`}},
+			},
+			`notify.0.if: column 16: unknown variable failed`,
+		},
+		{
+			map[string]interface{}{
+				"step": []interface{}{map[string]interface{}{"type": "script", "command": "make"}},
+				"github_settings": []interface{}{map[string]interface{}{
+					"filter_enabled":   true,
+					"filter_condition": `build.pull_request.labels includes /deploy/`,
+				}},
+			},
+			`github_settings.0.filter_condition: column 36: regular expressions can only be used with =~ and !~`,
+		},
+	} {
+		_, errs := r.Validate(testPipelineConfig(t, tc.config))
+		found := false
+		for _, err := range errs {
+			found = found || strings.Contains(err.Error(), tc.expected)
+		}
+		if !found {
+			t.Errorf("expected an error containing %q, got %v", tc.expected, errs)
+		}
+	}
+}
+
+func TestStepResource_limits(t *testing.T) {
+	r := stepResource(false)
+	for _, attr := range []string{"timeout_in_minutes", "concurrency", "parallelism"} {
+		for _, tc := range []struct {
+			value int
+			valid bool
+		}{
+			{-1, false},
+			{0, false},
+			{1, true},
+			{maxStepInt, true},
+			{maxStepInt + 1, false},
+		} {
+			_, es := r.Schema[attr].ValidateFunc(tc.value, attr)
+			if valid := len(es) == 0; valid != tc.valid {
+				t.Errorf("%s = %d: got errors %v", attr, tc.value, es)
+			}
+		}
+	}
+}
+
+// The steps are checked in a new pipeline, where extra_json is unknown unless
+// it is set, and replacing a step which was read from the API.
+func TestCustomizeDiffSteps(t *testing.T) {
+	r := resourcePipeline()
+	state := testPipelineState(t, map[string]interface{}{
+		"name":       "test",
+		"repository": "git@github.com:buildkite/example.git",
+		"step":       []interface{}{map[string]interface{}{"type": "script", "command": "make"}},
+	})
+
+	for _, tc := range []struct {
+		step     map[string]interface{}
+		expected string
+	}{
+		{map[string]interface{}{"type": "script", "command": "make"}, ""},
+		{map[string]interface{}{"type": "script", "extra_json": `{"plugins": [{"docker#v5.0.0": {"image": "golang"}}]}`}, ""},
+		{map[string]interface{}{"type": "waiter"}, ""},
+		{map[string]interface{}{"type": "script"}, "step.0: a script step requires a command"},
+		{map[string]interface{}{"type": "trigger"}, "step.0: a trigger step requires a trigger_project_slug"},
+		{
+			map[string]interface{}{"type": "manual", "name": "Release?", "command": "make"},
+			"step.0: command only applies to script steps, not manual steps",
+		},
+		{
+			map[string]interface{}{"type": "script", "command": "make", "prompt": "Ship it?"},
+			"step.0: prompt only applies to manual and input steps, not script steps",
+		},
+		{
+			map[string]interface{}{"type": "group", "name": "Lint", "step": []interface{}{
+				map[string]interface{}{"type": "script", "command": "make", "trigger_branch": "main"},
+			}},
+			"step.0.step.0: trigger_branch only applies to trigger steps, not script steps",
+		},
+	} {
+		for _, s := range []*terraform.InstanceState{nil, state} {
+			_, err := r.Diff(s, testPipelineConfig(t, map[string]interface{}{
+				"step": []interface{}{tc.step},
+			}), nil)
+			switch {
+			case tc.expected == "" && err != nil:
+				t.Errorf("%v: unexpected error %s", tc.step, err)
+			case tc.expected != "" && (err == nil || !strings.Contains(err.Error(), tc.expected)):
+				t.Errorf("%v: expected error %q, got %v", tc.step, tc.expected, err)
+			}
+		}
+	}
+}
+
+func TestCustomizeDiffFilters(t *testing.T) {
+	r := resourcePipeline()
+	step := []interface{}{map[string]interface{}{"type": "script", "command": "make"}}
+
+	for _, tc := range []struct {
+		config   map[string]interface{}
+		expected string
+	}{
+		{
+			map[string]interface{}{"skip_queued_branch_builds": true, "skip_queued_branch_builds_filter": "main"},
+			"",
+		},
+		{
+			map[string]interface{}{"cancel_running_branch_builds_filter": "!main"},
+			"cancel_running_branch_builds_filter: only applies when cancel_running_branch_builds is enabled",
+		},
+		{
+			map[string]interface{}{"github_settings": []interface{}{map[string]interface{}{
+				"filter_condition": "build.pull_request.draft != true",
+			}}},
+			"github_settings.0.filter_condition: only applies when filter_enabled is enabled",
+		},
+		{
+			map[string]interface{}{"github_settings": []interface{}{map[string]interface{}{
+				"pull_request_branch_filter_enabled":       true,
+				"pull_request_branch_filter_configuration": "feature/*",
+			}}},
+			"",
+		},
+	} {
+		tc.config["step"] = step
+		_, err := r.Diff(nil, testPipelineConfig(t, tc.config), nil)
+		switch {
+		case tc.expected == "" && err != nil:
+			t.Errorf("%v: unexpected error %s", tc.config, err)
+		case tc.expected != "" && (err == nil || !strings.Contains(err.Error(), tc.expected)):
+			t.Errorf("%v: expected error %q, got %v", tc.config, tc.expected, err)
+		}
+	}
+
+	// Settings read from the API are left alone until they are changed
+	state := testPipelineState(t, map[string]interface{}{
+		"name":       "test",
+		"repository": "git@github.com:buildkite/example.git",
+		"step":       step,
+		"github_settings": []interface{}{map[string]interface{}{
+			"filter_condition": "build.pull_request.draft != true",
+		}},
+	})
+	if _, err := r.Diff(state, testPipelineConfig(t, map[string]interface{}{"step": step}), nil); err != nil {
+		t.Errorf("unexpected error %s", err)
+	}
+}
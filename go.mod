@@ -3,7 +3,9 @@ module github.com/yougroupteam/terraform-buildkite
 go 1.12
 
 require (
+	github.com/hashicorp/go-multierror v1.0.0
 	github.com/hashicorp/hcl v0.0.0-20180404174102-ef8a98b0bbce // indirect
 	github.com/hashicorp/terraform v0.12.0
 	github.com/mitchellh/gox v1.0.1 // indirect
+	gopkg.in/yaml.v3 v3.0.1
 )